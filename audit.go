@@ -0,0 +1,173 @@
+package extdirect
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// RedactedValue replaces values of redacted arguments and fields in audit records.
+const RedactedValue = "[REDACTED]"
+
+// AuditRecord describes processed direct method call.
+type AuditRecord struct {
+	User     string
+	Action   string
+	Method   string
+	Tid      int
+	// Args are decoded arguments where structs and maps are converted to map[string]interface{}
+	// and values of redacted arguments and fields are replaced by RedactedValue.
+	Args     []interface{}
+	Status   CallStatus
+	Err      error
+	Duration time.Duration
+}
+
+// Auditor receives audit records of direct method calls.
+// Arguments of methods are redacted if method tags have `redact:"true"` and
+// fields of arguments are redacted if they have `redact:"true"` or `sensitive:"true"` tag.
+type Auditor interface {
+	Audit(record *AuditRecord)
+}
+
+// UserFunc returns identifier of user making request. Request may be nil if calls are processed outside of HTTP handler.
+type UserFunc func(c context.Context, r *http.Request) string
+
+// SetAuditor sets auditor of provider.
+func (provider *DirectServiceProvider) SetAuditor(auditor Auditor) {
+	provider.auditor = auditor
+}
+
+// SetUserFunc sets function identifying user of requests.
+func (provider *DirectServiceProvider) SetUserFunc(userFunc UserFunc) {
+	provider.userFunc = userFunc
+}
+
+func (provider *DirectServiceProvider) user(c context.Context, r *http.Request) string {
+	if provider.userFunc == nil {
+		return ""
+	}
+	return provider.userFunc(c, r)
+}
+
+func isRedacted(tag reflect.StructTag) bool {
+	return tag.Get("redact") == "true" || tag.Get("sensitive") == "true"
+}
+
+// hasRedactedFields reports whether type has redacted struct fields at any depth.
+func hasRedactedFields(t reflect.Type, seen map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return false
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); isRedacted(f.Tag) || hasRedactedFields(f.Type, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactArgs(args []reflect.Value, redactAll bool) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		if redactAll {
+			values[i] = RedactedValue
+		} else if arg.IsValid() {
+			values[i] = redactValue(arg)
+		}
+	}
+	return values
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// redactValue converts value into generic representation with redacted fields masked.
+func redactValue(v reflect.Value) interface{} {
+	t := v.Type()
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		// Marshaler encodes fields regardless of their tags, so value with redacted fields is masked as a whole.
+		if hasRedactedFields(t, make(map[reflect.Type]bool)) {
+			return RedactedValue
+		}
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem())
+	case reflect.Struct:
+		fields := make(map[string]interface{})
+		promoted := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := f.Name
+			if jsonName := strings.Split(f.Tag.Get("json"), ",")[0]; jsonName == "-" {
+				continue
+			} else if jsonName != "" {
+				name = jsonName
+			} else if f.Anonymous && !isRedacted(f.Tag) {
+				embeddedType := f.Type
+				if embeddedType.Kind() == reflect.Ptr {
+					embeddedType = embeddedType.Elem()
+				}
+				if embeddedType.Kind() == reflect.Struct {
+					// Fields of embedded struct are encoded into JSON as fields of outer struct which take precedence.
+					if embedded, ok := redactValue(v.Field(i)).(map[string]interface{}); ok {
+						for embeddedName, value := range embedded {
+							promoted[embeddedName] = value
+						}
+					}
+					continue
+				}
+			}
+			if isRedacted(f.Tag) {
+				fields[name] = RedactedValue
+			} else {
+				fields[name] = redactValue(v.Field(i))
+			}
+		}
+		for name, value := range promoted {
+			if _, ok := fields[name]; !ok {
+				fields[name] = value
+			}
+		}
+		return fields
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		entries := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			entries[fmt.Sprintf("%v", key.Interface())] = redactValue(v.MapIndex(key))
+		}
+		return entries
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && (v.IsNil() || t.Elem().Kind() == reflect.Uint8) {
+			return v.Interface()
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = redactValue(v.Index(i))
+		}
+		return items
+	}
+	return v.Interface()
+}
@@ -0,0 +1,162 @@
+package extdirect
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache stores results of direct methods with cache tag.
+type Cache interface {
+	// Get returns value of key if it is present and not expired.
+	Get(key string) (interface{}, bool)
+	// Set stores value of key expiring after ttl.
+	Set(key string, value interface{}, ttl time.Duration)
+	// DeletePrefix removes values of keys with prefix.
+	DeletePrefix(prefix string)
+}
+
+// CacheInvalidator invalidates cached results of direct methods.
+// Action field of type CacheInvalidator is set to provider before direct method call.
+type CacheInvalidator interface {
+	// InvalidateCache removes cached results of method of action or of all its methods if method is empty.
+	InvalidateCache(action, method string)
+	// InvalidateCacheArgs removes cached results of method called with args (for all users).
+	InvalidateCacheArgs(action, method string, args ...interface{}) error
+}
+
+var cacheInvalidatorType = reflect.TypeOf((*CacheInvalidator)(nil)).Elem()
+
+// SetCache sets cache of results of methods with `cache:"<ttl>"` tag, e.g. `cache:"5m"`
+// (in-memory LRU cache of 1000 results by default). Results are cached by action, method and arguments
+// and also by user (as identified by UserFunc) if method has `cacheperuser:"true"` tag. Nil disables caching.
+func (provider *DirectServiceProvider) SetCache(cache Cache) {
+	provider.cache = cache
+}
+
+// cacheKeyPrefix returns prefix of keys of cached results of method or of all methods of action if method is empty.
+func cacheKeyPrefix(action, method string) string {
+	if method == "" {
+		return action + "."
+	}
+	return action + "." + method + "\x00"
+}
+
+// cacheKey returns key of result of method call with encoded args or empty string if args cannot be encoded.
+func (provider *DirectServiceProvider) cacheKey(c context.Context, r *http.Request, action, method string, args []interface{}, perUser bool) string {
+	if args == nil {
+		args = []interface{}{}
+	}
+	argsData, err := provider.codec.Marshal(args)
+	if err != nil {
+		return ""
+	}
+	key := cacheKeyPrefix(action, method) + string(argsData) + "\x00"
+	if perUser {
+		key += provider.user(c, r)
+	}
+	return key
+}
+
+// InvalidateCache implements CacheInvalidator.
+func (provider *DirectServiceProvider) InvalidateCache(action, method string) {
+	if provider.cache != nil {
+		provider.cache.DeletePrefix(cacheKeyPrefix(action, method))
+	}
+}
+
+// InvalidateCacheArgs implements CacheInvalidator.
+func (provider *DirectServiceProvider) InvalidateCacheArgs(action, method string, args ...interface{}) error {
+	if provider.cache == nil {
+		return nil
+	}
+	if args == nil {
+		args = []interface{}{}
+	}
+	argsData, err := provider.codec.Marshal(args)
+	if err != nil {
+		return err
+	}
+	provider.cache.DeletePrefix(cacheKeyPrefix(action, method) + string(argsData) + "\x00")
+	return nil
+}
+
+type lruCacheEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// LRUCache is an in-memory Cache with limited number of values evicting least recently used ones.
+type LRUCache struct {
+	size    int
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	now     func() time.Time
+}
+
+// NewLRUCache creates in-memory cache of up to size values.
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{size: size, entries: make(map[string]*list.Element), order: list.New(), now: time.Now}
+}
+
+// Get implements Cache.
+func (cache *LRUCache) Get(key string) (interface{}, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*lruCacheEntry)
+	if !cache.now().Before(entry.expires) {
+		cache.remove(element)
+		return nil, false
+	}
+	cache.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// Set implements Cache.
+func (cache *LRUCache) Set(key string, value interface{}, ttl time.Duration) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	entry := &lruCacheEntry{key, value, cache.now().Add(ttl)}
+	if element, ok := cache.entries[key]; ok {
+		element.Value = entry
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.entries[key] = cache.order.PushFront(entry)
+	for cache.order.Len() > cache.size {
+		cache.remove(cache.order.Back())
+	}
+}
+
+// DeletePrefix implements Cache.
+func (cache *LRUCache) DeletePrefix(prefix string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	for key, element := range cache.entries {
+		if strings.HasPrefix(key, prefix) {
+			cache.remove(element)
+		}
+	}
+}
+
+// Len returns number of cached values including expired ones not removed yet.
+func (cache *LRUCache) Len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.order.Len()
+}
+
+func (cache *LRUCache) remove(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.entries, element.Value.(*lruCacheEntry).key)
+}
@@ -0,0 +1,64 @@
+package extdirect
+
+import (
+	"context"
+	"fmt"
+)
+
+// ErrException is an exception returned by direct method call.
+type ErrException struct {
+	Action  string
+	Method  string
+	Message string
+}
+
+func (err ErrException) Error() string {
+	return fmt.Sprintf("exception in %v.%v(): %v", err.Action, err.Method, err.Message)
+}
+
+// DirectCall is a direct method call made in process by CallBatch.
+type DirectCall struct {
+	Action string
+	Method string
+	Args   []interface{}
+	// Result is a result returned by method.
+	Result interface{}
+	// Err is an ErrException if call resulted in exception.
+	Err    error
+}
+
+// Call calls direct method in process as if it was requested by client and returns its result or ErrException.
+// Arguments are encoded with provider codec and decoded into method arguments like ones of client requests.
+func (provider *DirectServiceProvider) Call(c context.Context, action, method string, args ...interface{}) (interface{}, error) {
+	call := &DirectCall{Action: action, Method: method, Args: args}
+	if err := provider.CallBatch(c, call); err != nil {
+		return nil, err
+	}
+	return call.Result, call.Err
+}
+
+// CallBatch concurrently calls direct methods in process as single transaction and sets their results or exceptions.
+// Error is returned if arguments cannot be encoded.
+func (provider *DirectServiceProvider) CallBatch(c context.Context, calls ...*DirectCall) error {
+	reqs := make([]*request, len(calls))
+	for i, call := range calls {
+		args := call.Args
+		if args == nil {
+			args = []interface{}{}
+		}
+		data, err := provider.codec.Marshal(args)
+		if err != nil {
+			return err
+		}
+		reqs[i] = &request{Type: "rpc", Tid: i + 1, Action: call.Action, Method: call.Method, Data: data}
+	}
+
+	for i, resp := range provider.processRequests(c, nil, reqs) {
+		if resp.Type == "exception" {
+			calls[i].Err = ErrException{resp.Action, resp.Method, *resp.Message}
+		} else {
+			calls[i].Result = resp.Result
+		}
+	}
+	return nil
+}
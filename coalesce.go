@@ -0,0 +1,58 @@
+package extdirect
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// coalescer merges identical concurrent calls of methods with `coalesce:"true"` tag made by the same user,
+// so method is executed once and every call gets its response. Calls without user as identified by UserFunc
+// of provider are never merged, since response of one client must not be delivered to another.
+type coalescer struct {
+	mutex sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+type coalescedCall struct {
+	done chan struct{}
+	resp *response
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{calls: make(map[string]*coalescedCall)}
+}
+
+// coalesceKey returns key of identical calls: the same action, method, data, metadata and user.
+// Empty string is returned if method is not coalesced or call has no user.
+func (provider *DirectServiceProvider) coalesceKey(c context.Context, r *http.Request, req *request) string {
+	if !provider.actionsInfo[req.Action].DirectMethods[req.Method].coalesce {
+		return ""
+	}
+	user := provider.user(c, r)
+	if user == "" {
+		return ""
+	}
+	return req.Action + "." + req.Method + "\x00" + string(req.Data) + "\x00" + string(req.Metadata) + "\x00" + user
+}
+
+// join returns in-flight call of key or starts new one; it reports whether caller leads new call and must finish it.
+func (coalescer *coalescer) join(key string) (*coalescedCall, bool) {
+	coalescer.mutex.Lock()
+	defer coalescer.mutex.Unlock()
+	if call, ok := coalescer.calls[key]; ok {
+		return call, false
+	}
+	call := &coalescedCall{done: make(chan struct{})}
+	coalescer.calls[key] = call
+	return call, true
+}
+
+// finish delivers response of call led by caller to joined calls.
+func (coalescer *coalescer) finish(key string, call *coalescedCall, resp *response) {
+	coalescer.mutex.Lock()
+	delete(coalescer.calls, key)
+	coalescer.mutex.Unlock()
+	call.resp = resp
+	close(call.done)
+}
@@ -0,0 +1,27 @@
+package extdirect
+
+import (
+	"encoding/json"
+)
+
+// Codec encodes responses and decodes requests of direct transactions.
+// Decoding of request must support json.RawMessage targets since arguments are decoded one by one.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec is a default codec based on encoding/json package.
+type JSONCodec struct{}
+
+var _ Codec = JSONCodec{}
+
+// Marshal implements Codec.Marshal() with json.Marshal().
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal implements Codec.Unmarshal() with json.Unmarshal().
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,179 @@
+package extdirect
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Compressor creates writer compressing data written to w.
+// Writer may implement Flush() error to support flushing of streamed responses.
+type Compressor func(w io.Writer) io.WriteCloser
+
+type encodingCompressor struct {
+	encoding   string
+	compressor Compressor
+}
+
+// GzipCompressor is a compressor for gzip content encoding.
+func GzipCompressor(w io.Writer) io.WriteCloser {
+	return gzip.NewWriter(w)
+}
+
+// DeflateCompressor is a compressor for deflate content encoding (zlib format as required by HTTP).
+func DeflateCompressor(w io.Writer) io.WriteCloser {
+	return zlib.NewWriter(w)
+}
+
+// Compress enables compression of responses which are at least threshold bytes long.
+// Negative threshold disables compression.
+func (provider *DirectServiceProvider) Compress(threshold int) {
+	provider.compressionThreshold = threshold
+}
+
+// RegisterCompressor registers compressor for content encoding (e.g. "br" with brotli writer).
+// Compressors registered later are preferred when client accepts several encodings equally.
+func (provider *DirectServiceProvider) RegisterCompressor(encoding string, compressor Compressor) {
+	compressors := []encodingCompressor{{encoding, compressor}}
+	for _, c := range provider.compressors {
+		if c.encoding != encoding {
+			compressors = append(compressors, c)
+		}
+	}
+	provider.compressors = compressors
+}
+
+// compressResponse returns writer compressing response if it is enabled and accepted by client
+// and function which must be called after response is written.
+func (provider *DirectServiceProvider) compressResponse(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	if provider.compressionThreshold < 0 {
+		return w, func() {}
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	encodings := make([]string, len(provider.compressors))
+	for i, c := range provider.compressors {
+		encodings[i] = c.encoding
+	}
+	i := negotiateEncoding(r.Header.Get("Accept-Encoding"), encodings)
+	if i < 0 {
+		return w, func() {}
+	}
+
+	cw := &compressResponseWriter{
+		ResponseWriter: w,
+		encoding: provider.compressors[i].encoding,
+		compressor: provider.compressors[i].compressor,
+		threshold: provider.compressionThreshold,
+		status: http.StatusOK,
+	}
+	return cw, cw.close
+}
+
+// negotiateEncoding returns index of encoding with highest quality in Accept-Encoding header
+// or -1 if no encoding is acceptable.
+func negotiateEncoding(acceptEncoding string, encodings []string) int {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := -1, 0.0
+	for i, encoding := range encodings {
+		q, ok := qualities[encoding]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	return best
+}
+
+// compressResponseWriter buffers response until threshold is reached and then compresses it.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding   string
+	compressor Compressor
+	threshold  int
+	status     int
+	buf        []byte
+	w          io.WriteCloser
+}
+
+func (cw *compressResponseWriter) WriteHeader(status int) {
+	cw.status = status
+}
+
+func (cw *compressResponseWriter) Write(data []byte) (int, error) {
+	if cw.w != nil {
+		return cw.w.Write(data)
+	}
+	cw.buf = append(cw.buf, data...)
+	if len(cw.buf) >= cw.threshold {
+		if err := cw.start(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// Flush starts compression regardless of threshold since flushed responses are streamed.
+func (cw *compressResponseWriter) Flush() {
+	if cw.w == nil {
+		if err := cw.start(); err != nil {
+			return
+		}
+	}
+	if flusher, ok := cw.w.(interface {
+		Flush() error
+	}); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (cw *compressResponseWriter) start() error {
+	header := cw.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Encoding", cw.encoding)
+	cw.ResponseWriter.WriteHeader(cw.status)
+	cw.w = cw.compressor(cw.ResponseWriter)
+	buf := cw.buf
+	cw.buf = nil
+	_, err := cw.w.Write(buf)
+	return err
+}
+
+func (cw *compressResponseWriter) close() {
+	if cw.w != nil {
+		if err := cw.w.Close(); err != nil {
+			panic(err)
+		}
+		return
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if _, err := cw.ResponseWriter.Write(cw.buf); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,211 @@
+package extdirect
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ReadRequest is a read operation of Ext.data.proxy.Direct.
+type ReadRequest struct {
+	Page   int       `json:"page"`
+	Start  int       `json:"start"`
+	Limit  int       `json:"limit"`
+	Sort   []Sorter  `json:"sort"`
+	Filter []Filter  `json:"filter"`
+	Group  Groupers  `json:"group"`
+}
+
+// Sorter is a sorting of read request.
+type Sorter struct {
+	Property  string `json:"property"`
+	Direction string `json:"direction"`
+}
+
+// Filter is a filtering of read request.
+type Filter struct {
+	Property string      `json:"property"`
+	Value    interface{} `json:"value"`
+	Operator string      `json:"operator,omitempty"`
+}
+
+// Grouper is a grouping of read request.
+type Grouper struct {
+	Property  string `json:"property"`
+	Direction string `json:"direction"`
+}
+
+// Groupers are groupings of read request which store sends either as single object or as array.
+type Groupers []Grouper
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (groupers *Groupers) UnmarshalJSON(data []byte) error {
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '{' {
+		var grouper Grouper
+		if err := json.Unmarshal(data, &grouper); err != nil {
+			return err
+		}
+		*groupers = Groupers{grouper}
+		return nil
+	}
+	var items []Grouper
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	*groupers = Groupers(items)
+	return nil
+}
+
+// ReadResult is a result of CRUD operation understood by reader of proxy advertised for CrudAction.
+type ReadResult struct {
+	Total    int           `json:"total"`
+	Records  interface{}   `json:"records"`
+	Success  bool          `json:"success"`
+	Message  string        `json:"message,omitempty"`
+	MetaData interface{}   `json:"metaData,omitempty"`
+	Errors   []RecordError `json:"errors,omitempty"`
+}
+
+// RecordError is an error of writing single record of batch.
+type RecordError struct {
+	Index    int    `json:"index"`
+	ClientID string `json:"clientId,omitempty"`
+	Message  string `json:"message"`
+}
+
+// PhantomRecord is embedded into record type to carry client id of phantom record created in Ext store.
+// Records returned by create keep client id, so proxy maps phantom records to server ids.
+type PhantomRecord struct {
+	ClientID string `json:"clientId,omitempty"`
+}
+
+// GetClientID returns client id of phantom record.
+func (record PhantomRecord) GetClientID() string {
+	return record.ClientID
+}
+
+type clientIDRecord interface {
+	GetClientID() string
+}
+
+// WriteRecords writes records of batch atomically. Every record is written by write; if all of them are written,
+// result is successful with written records (as returned by write), so proxy maps phantom records to server ids.
+// Otherwise records written so far are rolled back by rollback in reverse order and result is not successful:
+// it has no records, errors of failed records and message joining their messages. Ext rejects whole batch
+// on unsuccessful result keeping all records phantom or dirty, so it is safe to retry. Rollback may be nil
+// if writes are undone otherwise, e.g. by rolling back database transaction when result is not successful.
+func WriteRecords[T any](records []T, write func(record T) (T, error), rollback func(record T)) *ReadResult {
+	result := &ReadResult{Success: true}
+	written := make([]T, 0, len(records))
+	var messages []string
+	for i, record := range records {
+		writtenRecord, err := write(record)
+		if err != nil {
+			recordErr := RecordError{Index: i, Message: err.Error()}
+			if r, ok := interface{}(record).(clientIDRecord); ok {
+				recordErr.ClientID = r.GetClientID()
+			}
+			result.Errors = append(result.Errors, recordErr)
+			messages = append(messages, err.Error())
+			continue
+		}
+		written = append(written, writtenRecord)
+	}
+
+	if len(result.Errors) > 0 {
+		if rollback != nil {
+			for i := len(written) - 1; i >= 0; i-- {
+				rollback(written[i])
+			}
+		}
+		result.Success = false
+		result.Message = strings.Join(messages, "; ")
+		result.Records = []T{}
+		return result
+	}
+	result.Records = written
+	result.Total = len(written)
+	return result
+}
+
+// CrudAction is implemented by actions serving Ext.data.proxy.Direct of store with records of type T.
+// Provider advertises proxy config for such actions in JavaScript() as <Namespace>.PROXIES.<Action>.
+// Records are always sent in arrays since advertised writer disables allowSingle, and phantom records
+// are sent with client id (see PhantomRecord and WriteRecords).
+type CrudAction[T any] interface {
+	Read(r *ReadRequest) (*ReadResult, error)
+	Create(records []T) (*ReadResult, error)
+	Update(records []T) (*ReadResult, error)
+	Destroy(records []T) (*ReadResult, error)
+}
+
+var readRequestType = reflect.TypeOf(&ReadRequest{})
+
+// isCrudAction reports whether type implements CrudAction for some record type.
+func isCrudAction(t reflect.Type) bool {
+	read, ok := t.MethodByName("Read")
+	if !ok || read.Type.NumIn() != 2 || read.Type.In(1) != readRequestType {
+		return false
+	}
+	for _, name := range []string{"Create", "Update", "Destroy"} {
+		m, ok := t.MethodByName(name)
+		if !ok || m.Type.NumIn() != 2 || m.Type.In(1).Kind() != reflect.Slice {
+			return false
+		}
+	}
+	return true
+}
+
+type directProxyConfig struct {
+	Type   string            `json:"type"`
+	API    map[string]string `json:"api"`
+	Reader map[string]string `json:"reader"`
+	Writer map[string]interface{} `json:"writer"`
+}
+
+// proxiesJSON returns JSON of proxy configs of CRUD actions or empty string if there are no such actions.
+func (provider DirectServiceProvider) proxiesJSON() (string, error) {
+	var actionNames []string
+	for actionName, actionInfo := range provider.actionsInfo {
+		if actionInfo.Crud {
+			actionNames = append(actionNames, actionName)
+		}
+	}
+	if len(actionNames) == 0 {
+		return "", nil
+	}
+	sort.Strings(actionNames)
+
+	proxies := make(map[string]directProxyConfig, len(actionNames))
+	for _, actionName := range actionNames {
+		prefix := provider.Namespace + "." + actionName + "."
+		proxies[actionName] = directProxyConfig{
+			Type: "direct",
+			API: map[string]string{
+				"read": prefix + "read",
+				"create": prefix + "create",
+				"update": prefix + "update",
+				"destroy": prefix + "destroy",
+			},
+			Reader: map[string]string{
+				"type": "json",
+				"rootProperty": "records",
+				"totalProperty": "total",
+				"successProperty": "success",
+				"messageProperty": "message",
+			},
+			Writer: map[string]interface{}{
+				"type": "json",
+				"allowSingle": false,
+				"clientIdProperty": "clientId",
+			},
+		}
+	}
+	jsonText, err := json.Marshal(proxies)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonText), nil
+}
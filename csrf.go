@@ -0,0 +1,225 @@
+package extdirect
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrCSRF occurs when transaction fails cross-site request forgery check.
+type ErrCSRF string
+
+func (err ErrCSRF) Error() string {
+	return fmt.Sprintf("CSRF check failed: %s", string(err))
+}
+
+// CSRF configures protection of transactions against cross-site request forgery.
+// API script embeds token bound to session into <Namespace>.CSRF_TOKEN and headers of REMOTE_API, and every
+// transaction must send it in header (or form field for form posts). Since any page can include API script,
+// token is embedded only if Origin or Referer of script request is the host of request or one of TrustedOrigins,
+// or if there are none, Sec-Fetch-Site header does not tell it is cross-site or same-site. Transaction failing the check gets
+// exception responses instead of calling methods. WebSocket handshake must send token in query parameter named
+// by FieldName (appended to wsUrl of WEBSOCKET_API) and its origin is always verified, since browsers cannot set
+// headers of handshake but send cookies with cross-site ones; handshake failing the check is rejected.
+type CSRF struct {
+	// Secret signs tokens.
+	Secret         []byte
+	// HeaderName is a header carrying token of JSON transactions ("X-CSRF-Token" by default).
+	HeaderName     string
+	// FieldName is a form field carrying token of form posts and query parameter carrying token of WebSocket
+	// handshakes ("extCSRFToken" by default).
+	FieldName      string
+	// CookieName is a name of cookie with random session id tokens are bound to if Session is nil
+	// ("extdirect_session" by default).
+	CookieName     string
+	// Session returns id of session tokens are bound to instead of session cookie.
+	Session        func(r *http.Request) string
+	// VerifyOrigin enables verification that Origin (or Referer if there is no Origin) header of transaction
+	// is the host of request or one of TrustedOrigins. Transaction without both headers fails verification.
+	VerifyOrigin   bool
+	// TrustedOrigins are origins like "https://app.example.com" allowed besides the host of request.
+	TrustedOrigins []string
+}
+
+// NewCSRF creates CSRF protection with secret and default names verifying origins.
+// Random secret is generated if secret is nil, so tokens are valid while process runs.
+func NewCSRF(secret []byte) *CSRF {
+	if secret == nil {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(err)
+		}
+	}
+	return &CSRF{
+		Secret: secret,
+		HeaderName: "X-CSRF-Token",
+		FieldName: "extCSRFToken",
+		CookieName: "extdirect_session",
+		VerifyOrigin: true,
+	}
+}
+
+// SetCSRF sets CSRF protection of provider. Nil disables protection.
+func (provider *DirectServiceProvider) SetCSRF(csrf *CSRF) {
+	provider.csrf = csrf
+}
+
+// session returns session id of request tokens are bound to; new session cookie is set into response
+// if w is not nil and request has no session.
+func (csrf *CSRF) session(w http.ResponseWriter, r *http.Request) string {
+	if csrf.Session != nil {
+		return csrf.Session(r)
+	}
+	if cookie, err := r.Cookie(csrf.CookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	if w == nil {
+		return ""
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	session := base64.RawURLEncoding.EncodeToString(id)
+	http.SetCookie(w, &http.Cookie{
+		Name: csrf.CookieName,
+		Value: session,
+		Path: "/",
+		HttpOnly: true,
+		Secure: r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return session
+}
+
+func (csrf *CSRF) token(session string) string {
+	mac := hmac.New(sha256.New, csrf.Secret)
+	mac.Write([]byte(session))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Token returns token for session of request, setting session cookie into response if request has none.
+func (csrf *CSRF) Token(w http.ResponseWriter, r *http.Request) string {
+	return csrf.token(csrf.session(w, r))
+}
+
+// javaScript returns script adding token of request to API of namespace and to URL of WebSocket API if it is set.
+// Empty string is returned if script request comes from untrusted page (see embedsToken).
+func (csrf *CSRF) javaScript(w http.ResponseWriter, r *http.Request, namespace, webSocketURL string) string {
+	if !csrf.embedsToken(r) {
+		return ""
+	}
+	token := csrf.Token(w, r)
+	tokenJSON, _ := json.Marshal(token)
+	header, _ := json.Marshal(csrf.HeaderName)
+	js := fmt.Sprintf(";%[1]s.CSRF_TOKEN=%[2]s;%[1]s.REMOTE_API.headers=Ext.apply(%[1]s.REMOTE_API.headers||{},{%[3]s:%[2]s})",
+		namespace, string(tokenJSON), string(header))
+	if webSocketURL != "" {
+		separator := "?"
+		if strings.Contains(webSocketURL, "?") {
+			separator = "&"
+		}
+		query, _ := json.Marshal(separator + url.Values{csrf.FieldName: {token}}.Encode())
+		js += fmt.Sprintf(";%s.WEBSOCKET_API.wsUrl+=%s", namespace, string(query))
+	}
+	return js
+}
+
+// verify checks origin of request and token sent in header or, for form posts, in formToken.
+func (csrf *CSRF) verify(r *http.Request, formToken string) error {
+	if csrf.VerifyOrigin {
+		if err := csrf.verifyOrigin(r); err != nil {
+			return err
+		}
+	}
+	return csrf.verifyToken(r, formToken)
+}
+
+// verifyWebSocket checks token of WebSocket handshake sent in header or query parameter.
+// Origin of handshake is verified by WebSocket handler regardless of CSRF protection.
+func (csrf *CSRF) verifyWebSocket(r *http.Request) error {
+	return csrf.verifyToken(r, r.URL.Query().Get(csrf.FieldName))
+}
+
+// verifyToken checks token sent in header or, if there is no header, fallbackToken against session of request.
+func (csrf *CSRF) verifyToken(r *http.Request, fallbackToken string) error {
+	token := r.Header.Get(csrf.HeaderName)
+	if token == "" {
+		token = fallbackToken
+	}
+	if token == "" {
+		return ErrCSRF("missing token")
+	}
+	session := csrf.session(nil, r)
+	if session == "" {
+		return ErrCSRF("missing session")
+	}
+	if !hmac.Equal([]byte(token), []byte(csrf.token(session))) {
+		return ErrCSRF("invalid token")
+	}
+	return nil
+}
+
+// requestOrigin returns Origin header of request or origin of Referer header if there is no Origin.
+// Empty string is returned if request has neither.
+func requestOrigin(r *http.Request) (string, error) {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		return origin, nil
+	}
+	referer := r.Header.Get("Referer")
+	if referer == "" {
+		return "", nil
+	}
+	refererURL, err := url.Parse(referer)
+	if err != nil {
+		return "", ErrCSRF("invalid referer")
+	}
+	return refererURL.Scheme + "://" + refererURL.Host, nil
+}
+
+// verifyOrigin checks that Origin or Referer header of request is the host of request or trusted origin.
+// Request without both headers fails the check.
+func (csrf *CSRF) verifyOrigin(r *http.Request) error {
+	origin, err := requestOrigin(r)
+	if err != nil {
+		return err
+	}
+	if origin == "" {
+		return ErrCSRF("missing origin")
+	}
+	if !isTrustedOrigin(r, origin, csrf.TrustedOrigins) {
+		return ErrCSRF(fmt.Sprintf("untrusted origin %s", origin))
+	}
+	return nil
+}
+
+// embedsToken reports whether API script requested by r may carry token: script is requested by page of the host
+// of request or of trusted origin as told by Origin or Referer header, or if there are none, by Sec-Fetch-Site.
+// Any page can include script with <script src> and read token from it otherwise.
+func (csrf *CSRF) embedsToken(r *http.Request) bool {
+	origin, err := requestOrigin(r)
+	if err != nil {
+		return false
+	}
+	if origin != "" {
+		return isTrustedOrigin(r, origin, csrf.TrustedOrigins)
+	}
+	site := r.Header.Get("Sec-Fetch-Site")
+	return site != "cross-site" && site != "same-site"
+}
+
+// exceptionResponses returns exception responses with message of err for requests.
+func exceptionResponses(reqs []*request, err error) []*response {
+	resps := make([]*response, len(reqs))
+	message := err.Error()
+	for i, req := range reqs {
+		resps[i] = &response{Type: "exception", Tid: req.Tid, Action: req.Action, Method: req.Method, Message: &message}
+	}
+	return resps
+}
@@ -0,0 +1,72 @@
+package extdirect
+
+import (
+	"context"
+	"sync"
+)
+
+type eventQueueKey struct{}
+
+// eventQueue collects events emitted by direct methods of transaction.
+type eventQueue struct {
+	mutex  sync.Mutex
+	events []*event
+}
+
+// withEventQueue returns context carrying new event queue for transaction.
+func withEventQueue(c context.Context) (context.Context, *eventQueue) {
+	queue := &eventQueue{}
+	return context.WithValue(contextOrBackground(c), eventQueueKey{}, queue), queue
+}
+
+// Emit queues event to be appended to response array of transaction direct method is called in
+// and fired by Ext.direct.Manager on client. Context must be the one set to action of the method.
+// It returns false if events cannot be delivered with responses, e.g. for form posts or in-process calls.
+func Emit(c context.Context, name string, data interface{}) bool {
+	if c == nil {
+		return false
+	}
+	queue, ok := c.Value(eventQueueKey{}).(*eventQueue)
+	if !ok {
+		return false
+	}
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.events = append(queue.events, &event{"event", name, data})
+	return true
+}
+
+// discardEvents drops events queued in transaction of context.
+func discardEvents(c context.Context) {
+	if c == nil {
+		return
+	}
+	if queue, ok := c.Value(eventQueueKey{}).(*eventQueue); ok {
+		queue.mutex.Lock()
+		defer queue.mutex.Unlock()
+		queue.events = nil
+	}
+}
+
+// encodables returns queued events to encode after responses.
+func (queue *eventQueue) encodables() []interface{} {
+	if queue == nil {
+		return nil
+	}
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	values := make([]interface{}, len(queue.events))
+	for i, ev := range queue.events {
+		values[i] = ev
+	}
+	return values
+}
+
+// encodables returns values to encode for response array of transaction: responses followed by emitted events.
+func encodables(resps []*response, events *eventQueue) []interface{} {
+	values := make([]interface{}, len(resps))
+	for i, resp := range resps {
+		values[i] = resp.encodable()
+	}
+	return append(values, events.encodables()...)
+}
@@ -1,19 +1,19 @@
 package main
 
 import (
-	"github.com/zenazn/goji"
-	"github.com/hypebeast/gojistatic"
 	"github.com/nbgo/extdirect"
 	"reflect"
 	"net/http"
-	"github.com/zenazn/goji/web"
 	"fmt"
 	"time"
 	"errors"
-	gcontext "github.com/goji/context"
-	"golang.org/x/net/context"
+	"context"
+	"log"
+	"flag"
 )
 
+//go:generate go run . -dts public/api.d.ts
+
 type GetDataRequest struct {
 	Page   int
 	Start  int
@@ -99,11 +99,17 @@ func (this Db) UpdateBasicInfo(data map[string]string) (result *extdirect.Direct
 }
 
 func main() {
+	dts := flag.String("dts", "", "write TypeScript declarations of API into file and exit")
+	flag.Parse()
+
 	extdirect.Provider.RegisterAction(reflect.TypeOf(Db{}))
-	goji.Get(extdirect.Provider.URL, extdirect.API(extdirect.Provider))
-	goji.Post(extdirect.Provider.URL, func(c web.C, w http.ResponseWriter, r *http.Request) {
-		extdirect.ActionsHandlerCtx(extdirect.Provider)(gcontext.FromC(c), w, r)
-	})
-	goji.Use(gojistatic.Static("public", gojistatic.StaticOptions{SkipLogging:true}))
-	goji.Serve()
+	if *dts != "" {
+		if err := extdirect.Provider.WriteTypeScript(*dts); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	extdirect.Provider.Mount(http.DefaultServeMux)
+	http.Handle("/", http.FileServer(http.Dir("public")))
+	log.Fatal(http.ListenAndServe(":8000", nil))
 }
\ No newline at end of file
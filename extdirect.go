@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"strings"
 	"fmt"
+	"time"
 )
 
 // DirectMethodTags serves to host tags for some direct method.
@@ -34,6 +35,26 @@ type DirectServiceProvider struct {
 	actionsInfo map[string]directActionInfo
 	debug       bool
 	profile     bool
+	emptyCollections bool
+	stream      bool
+	codec       Codec
+	logger      Logger
+	metrics     MetricsSink
+	tracer      Tracer
+	auditor     Auditor
+	userFunc    UserFunc
+	webSocket   *webSocketHub
+	eventStream *eventStreamBroker
+	channelAuthFunc ChannelAuthFunc
+	csrf        *CSRF
+	rateLimiter RateLimiter
+	clientIDFunc ClientIDFunc
+	cache       Cache
+	idempotency *idempotency
+	coalescer   *coalescer
+	unitOfWork  UnitOfWorkFunc
+	compressors []encodingCompressor
+	compressionThreshold int
 }
 
 type directAction []directMethod
@@ -43,6 +64,14 @@ type directMethod struct {
 	// Method declaration MUST have one of the following mutually exclusive properties that describe the Method’s calling convention:
 	Len         *int `json:"len,omitempty"`
 	FormHandler *bool `json:"formHander,omitempty"`
+	Metadata    *directMetadata `json:"metadata,omitempty"`
+	redact      bool
+	// metadataParam is set if the last method parameter receives call metadata.
+	metadataParam bool
+	rateLimit     *rateLimit
+	cacheTTL      time.Duration
+	cachePerUser  bool
+	coalesce      bool
 }
 
 // DirectFormHandlerResult is a result of form handler execution.
@@ -55,6 +84,7 @@ type directActionInfo struct {
 	Type          reflect.Type
 	Methods       map[string]reflect.Method
 	DirectMethods map[string]directMethod
+	Crud          bool
 }
 
 // JSON returns provider as JSON string.
@@ -76,13 +106,51 @@ func (provider *DirectServiceProvider) Profile(profile bool) {
 	provider.profile = profile
 }
 
+// EmptyCollections enables/disables encoding of nil slice and map results as [] and {} instead of null.
+func (provider *DirectServiceProvider) EmptyCollections(emptyCollections bool) {
+	provider.emptyCollections = emptyCollections
+}
+
+// Stream enables/disables streaming of batch responses: each response is written and flushed
+// as soon as it and preceding ones are ready instead of waiting for the whole batch.
+func (provider *DirectServiceProvider) Stream(stream bool) {
+	provider.stream = stream
+}
+
+// SetCodec sets codec used to decode requests and encode responses of provider.
+func (provider *DirectServiceProvider) SetCodec(codec Codec) {
+	provider.codec = codec
+}
+
 // JavaScript returns javascript declaration of the provider.
 func (provider DirectServiceProvider) JavaScript() (string, error) {
 	apiJSON, err := provider.JSON();
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("Ext.ns(\"%s\");%s.REMOTE_API=%s", provider.Namespace, provider.Namespace, apiJSON), nil
+	js := fmt.Sprintf("Ext.ns(\"%s\");%s.REMOTE_API=%s", provider.Namespace, provider.Namespace, apiJSON)
+	proxiesJSON, err := provider.proxiesJSON()
+	if err != nil {
+		return "", err
+	}
+	if proxiesJSON != "" {
+		js += fmt.Sprintf(";%s.PROXIES=%s", provider.Namespace, proxiesJSON)
+	}
+	webSocketJS, err := provider.webSocketJavaScript()
+	if err != nil {
+		return "", err
+	}
+	if webSocketJS != "" {
+		js += ";" + webSocketJS
+	}
+	eventSourceJS, err := provider.eventSourceJavaScript()
+	if err != nil {
+		return "", err
+	}
+	if eventSourceJS != "" {
+		js += ";" + eventSourceJS
+	}
+	return js, nil
 }
 
 // RegisterAction registers action.
@@ -94,7 +162,7 @@ func (provider *DirectServiceProvider) RegisterAction(typeInfo reflect.Type) {
 	}
 
 	if debug {
-		log.Print(fmt.Sprintf("Register action %v", actionTypeName))
+		provider.log().Debug(fmt.Sprintf("Register action %v", actionTypeName))
 	}
 
 	methodsLen := typeInfo.NumMethod()
@@ -103,38 +171,59 @@ func (provider *DirectServiceProvider) RegisterAction(typeInfo reflect.Type) {
 	directMethods := make(map[string]directMethod, 0)
 
 	if debug {
-		log.Print(fmt.Sprintf("\twith %v method(s)", methodsLen))
+		provider.log().Debug(fmt.Sprintf("\twith %v method(s)", methodsLen))
 	}
 
 	for i := 0; i < methodsLen; i++ {
 		methodInfo := typeInfo.Method(i)
 
 		if debug {
-			log.Print(fmt.Sprintf("\tregister method %v", methodInfo.Name))
+			provider.log().Debug(fmt.Sprintf("\tregister method %v", methodInfo.Name))
 		}
 
 		argsLen := methodInfo.Type.NumIn() - 1
 		directMethodName := firstCharToLower(methodInfo.Name)
-		directMethod := directMethod{Name: directMethodName}
+		directMethod := directMethod{Name: directMethodName, metadataParam: hasMetadataParam(methodInfo.Type)}
+		if directMethod.metadataParam {
+			argsLen--
+		}
 
 		if debug {
-			log.Print(fmt.Sprintf("\t\twith args len = %v", argsLen))
-			log.Print("\t\tget method tags")
+			provider.log().Debug(fmt.Sprintf("\t\twith args len = %v", argsLen))
+			provider.log().Debug("\t\tget method tags")
 		}
 
 		// Get method tags.
-		if tagsField := getDirectMethodTags(typeInfo, methodInfo.Name, debug); tagsField != nil {
+		if tagsField := provider.getDirectMethodTags(typeInfo, methodInfo.Name); tagsField != nil {
 			if debug {
-				log.Print("\t\t\ttags found")
+				provider.log().Debug("\t\t\ttags found")
 			}
 
 			if tagsField.Tag.Get("formhandler") == "true" {
 				directMethod.FormHandler = new(bool)
 				*directMethod.FormHandler = true
 			}
+			directMethod.redact = isRedacted(tagsField.Tag)
+			directMethod.Metadata = metadataFromTag(tagsField.Tag)
+			if tag := tagsField.Tag.Get("ratelimit"); tag != "" {
+				limit, err := parseRateLimit(tag)
+				if err != nil {
+					panic(fmt.Errorf("%s.%s: %v", actionTypeName, methodInfo.Name, err))
+				}
+				directMethod.rateLimit = limit
+			}
+			if tag := tagsField.Tag.Get("cache"); tag != "" {
+				ttl, err := time.ParseDuration(tag)
+				if err != nil || ttl <= 0 {
+					panic(fmt.Errorf("%s.%s: invalid cache duration %q", actionTypeName, methodInfo.Name, tag))
+				}
+				directMethod.cacheTTL = ttl
+				directMethod.cachePerUser = tagsField.Tag.Get("cacheperuser") == "true"
+			}
+			directMethod.coalesce = tagsField.Tag.Get("coalesce") == "true"
 		} else {
 			if debug {
-				log.Print("\t\t\tno tags found")
+				provider.log().Debug("\t\t\tno tags found")
 			}
 		}
 
@@ -153,6 +242,7 @@ func (provider *DirectServiceProvider) RegisterAction(typeInfo reflect.Type) {
 		Type: typeInfo,
 		Methods: methods,
 		DirectMethods: directMethods,
+		Crud: isCrudAction(typeInfo),
 	}
 }
 
@@ -172,6 +262,14 @@ func NewProvider() (provider *DirectServiceProvider) {
 		Timeout: 30000,
 		Actions: make(map[string]directAction),
 		actionsInfo: make(map[string]directActionInfo),
+		codec: JSONCodec{},
+		compressors: []encodingCompressor{{"gzip", GzipCompressor}, {"deflate", DeflateCompressor}},
+		compressionThreshold: -1,
+		webSocket: &webSocketHub{conns: make(map[*webSocketConn]bool)},
+		eventStream: newEventStreamBroker(),
+		rateLimiter: NewTokenBucketLimiter(),
+		cache: NewLRUCache(1000),
+		coalescer: newCoalescer(),
 	}
 
 	return
@@ -190,28 +288,29 @@ func firstCharToLower(s string) string {
 	return string(bytes.Join([][]byte{lc, rest}, nil))
 }
 
-func getDirectMethodTags(t reflect.Type, methodName string, debug bool) *reflect.StructField {
+func (provider *DirectServiceProvider) getDirectMethodTags(t reflect.Type, methodName string) *reflect.StructField {
+	debug := provider.debug
 	fieldsLen := t.NumField()
 	dmt := reflect.TypeOf(DirectMethodTags{})
 
 	if debug {
-		log.Print(fmt.Sprintf("\t\t\tsearch tag among %v fields", fieldsLen))
+		provider.log().Debug(fmt.Sprintf("\t\t\tsearch tag among %v fields", fieldsLen))
 	}
 
 	for i := 0; i < fieldsLen; i++ {
 		f := t.Field(i)
 		if debug {
-			log.Print(fmt.Sprintf("\t\t\t\tfield %v of type %v", f.Name, f.Type))
+			provider.log().Debug(fmt.Sprintf("\t\t\t\tfield %v of type %v", f.Name, f.Type))
 		}
 		if f.Name == (methodName + "Tags") && f.Type == dmt {
 			if debug {
-				log.Print("\t\t\t\t\tis a tag")
+				provider.log().Debug("\t\t\t\t\tis a tag")
 			}
 
 			return &f;
 		}
 		if debug {
-			log.Print(fmt.Sprintf("\t\t\t\t\tis NOT a tag: nameOk=%v, typeOk=%v", f.Name == (methodName + "Tags"), f.Type == dmt))
+			provider.log().Debug(fmt.Sprintf("\t\t\t\t\tis NOT a tag: nameOk=%v, typeOk=%v", f.Name == (methodName + "Tags"), f.Type == dmt))
 		}
 	}
 
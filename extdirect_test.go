@@ -21,6 +21,16 @@ import (
 	"golang.org/x/net/context"
 	"github.com/nbgo/fail"
 	"github.com/nbgo/jsontime"
+	"sync/atomic"
+	"compress/gzip"
+	"compress/zlib"
+	"sync"
+	"bytes"
+	stdlog "log"
+	"log/slog"
+	"golang.org/x/net/websocket"
+	"bufio"
+	"net/url"
 )
 
 var providerDebug = true
@@ -109,6 +119,433 @@ func (this Db) TestTime(r *RequestWithTime) string {
 	return time.Time(*r.Timestamp).Format(time.RFC3339Nano)
 }
 
+type Results struct{}
+
+func (this Results) False() bool {
+	return false
+}
+func (this Results) Zero() int {
+	return 0
+}
+func (this Results) EmptyString() string {
+	return ""
+}
+func (this Results) NilSlice() []string {
+	return nil
+}
+func (this Results) NilMap() map[string]int {
+	return nil
+}
+func (this Results) NilSliceInterface() interface{} {
+	var result []int
+	return result
+}
+func (this Results) Void() {
+}
+
+type countingCodec struct {
+	JSONCodec
+	marshalled   int32
+	unmarshalled int32
+}
+
+func (codec *countingCodec) Marshal(v interface{}) ([]byte, error) {
+	atomic.AddInt32(&codec.marshalled, 1)
+	return codec.JSONCodec.Marshal(v)
+}
+func (codec *countingCodec) Unmarshal(data []byte, v interface{}) error {
+	atomic.AddInt32(&codec.unmarshalled, 1)
+	return codec.JSONCodec.Unmarshal(data, v)
+}
+
+type Credentials struct {
+	Login    string `json:"login"`
+	Password string `json:"password" redact:"true"`
+	Token    string `sensitive:"true"`
+}
+
+type Registration struct {
+	Credentials
+	Email string `json:"email"`
+}
+
+type APIKey struct {
+	Name   string
+	Secret string `redact:"true"`
+}
+
+func (key APIKey) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"name": key.Name, "secret": key.Secret})
+}
+
+type Accounts struct {
+	SetSecretTags DirectMethodTags `redact:"true"`
+}
+
+func (this Accounts) SignIn(credentials *Credentials, remember bool) (bool, error) {
+	if credentials.Password != "secret" {
+		return false, errors.New("invalid password")
+	}
+	return true, nil
+}
+func (this Accounts) SetSecret(secret string) {
+}
+
+type Notifier struct {
+	C         context.Context
+	Publisher Publisher
+}
+
+func (this Notifier) Notify(channel string, message string) error {
+	return this.Publisher.Publish(channel, "notified", message)
+}
+func (this Notifier) Rename(id int, name string) string {
+	Emit(this.C, "recordChanged", map[string]interface{}{"id": id, "name": name})
+	return name
+}
+
+type LoadMetadata struct {
+	DirectMetadata
+	Locale string `json:"locale"`
+}
+
+type Catalog struct {
+	C        context.Context
+	LoadTags DirectMethodTags `metadataparams:"locale"`
+	FindTags DirectMethodTags `metadatalen:"1"`
+}
+
+func (this Catalog) Load(id int, m *LoadMetadata) string {
+	if m == nil {
+		return fmt.Sprint(id)
+	}
+	return fmt.Sprintf("%d:%s", id, m.Locale)
+}
+func (this Catalog) Find(name string) string {
+	var metadata []string
+	if ok, err := DecodeMetadata(this.C, &metadata); !ok || err != nil {
+		return name
+	}
+	return name + ":" + strings.Join(metadata, ",")
+}
+
+type Reports struct {
+	ExportTags DirectMethodTags `ratelimit:"2/m"`
+}
+
+func (this Reports) Export() string {
+	return "exported"
+}
+
+type InvalidLimitReports struct {
+	ExportTags DirectMethodTags `ratelimit:"10/w"`
+}
+
+func (this InvalidLimitReports) Export() string {
+	return "exported"
+}
+
+var lookupCalls int32
+
+type Lookups struct {
+	C             context.Context
+	Cache         CacheInvalidator
+	CountriesTags DirectMethodTags `cache:"5m"`
+	GreetingTags  DirectMethodTags `cache:"5m" cacheperuser:"true"`
+}
+
+func (this Lookups) Countries(region string) []string {
+	n := atomic.AddInt32(&lookupCalls, 1)
+	return []string{fmt.Sprintf("%s%d", region, n)}
+}
+func (this Lookups) Greeting() string {
+	return fmt.Sprintf("hello %v #%d", this.C.Value("user"), atomic.AddInt32(&lookupCalls, 1))
+}
+func (this Lookups) AddCountry(region string) error {
+	return this.Cache.InvalidateCacheArgs("Lookups", "countries", region)
+}
+func (this Lookups) Reset() {
+	this.Cache.InvalidateCache("Lookups", "")
+}
+
+var orderCalls int32
+var ordersGate chan struct{}
+
+type Orders struct {
+}
+
+func (this Orders) Update(id int) string {
+	return fmt.Sprintf("updated %d #%d", id, atomic.AddInt32(&orderCalls, 1))
+}
+func (this Orders) Charge() (string, error) {
+	n := atomic.AddInt32(&orderCalls, 1)
+	if n == 1 {
+		return "", errors.New("declined")
+	}
+	return fmt.Sprintf("charged #%d", n), nil
+}
+func (this Orders) Slow() int32 {
+	<-ordersGate
+	return atomic.AddInt32(&orderCalls, 1)
+}
+
+var dashboardCalls int32
+var dashboardGate chan struct{}
+var dashboardEntered chan string
+
+type Dashboard struct {
+	GetRecordsTags DirectMethodTags `coalesce:"true"`
+	GetTotalsTags  DirectMethodTags `coalesce:"true" ratelimit:"1/h"`
+}
+
+func (this Dashboard) GetRecords(panel string) string {
+	dashboardEntered <- panel
+	<-dashboardGate
+	return fmt.Sprintf("%s #%d", panel, atomic.AddInt32(&dashboardCalls, 1))
+}
+func (this Dashboard) GetTotals(panel string) string {
+	return this.GetRecords(panel)
+}
+
+// waitingLogger sends debug messages about calls waiting for identical ones to channel.
+type waitingLogger struct {
+	waiting chan string
+}
+
+func (logger waitingLogger) Debug(msg string, keysAndValues ...interface{}) {
+	if strings.HasPrefix(msg, "Wait for identical call") {
+		logger.waiting <- msg
+	}
+}
+func (logger waitingLogger) Info(msg string, keysAndValues ...interface{}) {
+}
+func (logger waitingLogger) Warn(msg string, keysAndValues ...interface{}) {
+}
+func (logger waitingLogger) Error(msg string, keysAndValues ...interface{}) {
+}
+
+type recordingUnitOfWork struct {
+	ops       []string
+	commitErr error
+	rollback  error
+}
+
+func (uow *recordingUnitOfWork) Commit() error {
+	uow.ops = append(uow.ops, "commit")
+	return uow.commitErr
+}
+func (uow *recordingUnitOfWork) Rollback(err error) {
+	uow.ops = append(uow.ops, "rollback")
+	uow.rollback = err
+}
+
+type Invoices struct {
+	C         context.Context
+	TotalTags DirectMethodTags `cache:"1m"`
+}
+
+func (this Invoices) SaveHeader(id int) int {
+	if uow, ok := CurrentUnitOfWork(this.C).(*recordingUnitOfWork); ok {
+		uow.ops = append(uow.ops, fmt.Sprintf("header %d", id))
+	}
+	return id
+}
+func (this Invoices) SaveLine(n int) (int, error) {
+	uow := CurrentUnitOfWork(this.C).(*recordingUnitOfWork)
+	if n < 0 {
+		return 0, errors.New("invalid line")
+	}
+	time.Sleep(time.Duration(10 - n) * time.Millisecond)
+	uow.ops = append(uow.ops, fmt.Sprintf("line %d", n))
+	Emit(this.C, "lineSaved", n)
+	return n, nil
+}
+func (this Invoices) Total() int {
+	uow := CurrentUnitOfWork(this.C).(*recordingUnitOfWork)
+	uow.ops = append(uow.ops, "total")
+	return len(uow.ops)
+}
+
+// routeMux returns route from Handle like gorilla/mux.Router does.
+type routeMux struct {
+	*http.ServeMux
+}
+
+func (mux routeMux) Handle(pattern string, handler http.Handler) *string {
+	mux.ServeMux.Handle(pattern, handler)
+	return &pattern
+}
+
+// methodMux registers handlers per HTTP method like httprouter.Router does.
+type methodMux map[string]http.Handler
+
+func (mux methodMux) Handler(method, path string, handler http.Handler) {
+	mux[method + " " + path] = handler
+}
+func (mux methodMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler, ok := mux[r.Method + " " + r.URL.Path]; ok {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// notifyingCache sends keys looked up in wrapped cache to channel.
+type notifyingCache struct {
+	Cache
+	gets chan string
+}
+
+func (cache notifyingCache) Get(key string) (interface{}, bool) {
+	cache.gets <- key
+	return cache.Cache.Get(key)
+}
+
+// receiveWithin returns value received from channel or fails if nothing is received in time.
+func receiveWithin[T any](ch chan T) (value T) {
+	select {
+	case value = <-ch:
+	case <-time.After(5 * time.Second):
+		So(fmt.Errorf("nothing received within 5s"), ShouldBeNil)
+	}
+	return
+}
+
+type recordingAuditor struct {
+	sync.Mutex
+	records []*AuditRecord
+}
+
+func (auditor *recordingAuditor) Audit(record *AuditRecord) {
+	auditor.Lock()
+	defer auditor.Unlock()
+	auditor.records = append(auditor.records, record)
+}
+func (auditor *recordingAuditor) record(tid int) *AuditRecord {
+	auditor.Lock()
+	defer auditor.Unlock()
+	for _, record := range auditor.records {
+		if record.Tid == tid {
+			return record
+		}
+	}
+	return nil
+}
+
+type Address struct {
+	City string
+}
+
+type Person struct {
+	ID      int `json:"id" idproperty:"true"`
+	Name    string `json:"name"`
+	Email   *string `json:"email,omitempty"`
+	Tags    []string `json:"tags"`
+	Born    time.Time `json:"born"`
+	Address
+	secret  string
+	Ignored string `json:"-"`
+	Extra   map[string]interface{} `json:"extra-data"`
+}
+
+type People struct{}
+
+func (this People) GetPeople(filter map[string]string, limit int) ([]*Person, error) {
+	return nil, nil
+}
+func (this People) Ping() {
+}
+func (this People) Save(person Person) bool {
+	return true
+}
+func (this People) Remove(ids []int) bool {
+	return true
+}
+
+type User struct {
+	PhantomRecord
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type Users struct{}
+
+var _ CrudAction[User] = Users{}
+
+// usersStore keeps users created by Users.Create.
+var usersStore = struct {
+	sync.Mutex
+	users map[int]User
+}{users: make(map[int]User)}
+
+func (this Users) Read(r *ReadRequest) (*ReadResult, error) {
+	return &ReadResult{Total: 1, Records: []User{{ID: 1, Name: fmt.Sprintf("%v %v %v", r.Sort, r.Filter, r.Group)}}, Success: true}, nil
+}
+func (this Users) Create(records []User) (*ReadResult, error) {
+	nextID := 10
+	return WriteRecords(records, func(record User) (User, error) {
+		if record.Name == "" {
+			return record, errors.New("name is required")
+		}
+		record.ID = nextID
+		nextID++
+		usersStore.Lock()
+		defer usersStore.Unlock()
+		usersStore.users[record.ID] = record
+		return record, nil
+	}, func(record User) {
+		usersStore.Lock()
+		defer usersStore.Unlock()
+		delete(usersStore.users, record.ID)
+	}), nil
+}
+func (this Users) Update(records []User) (*ReadResult, error) {
+	return &ReadResult{Total: len(records), Records: records, Success: true}, nil
+}
+func (this Users) Destroy(records []User) (*ReadResult, error) {
+	return &ReadResult{Success: true}, nil
+}
+
+type logRecord struct {
+	level  string
+	msg    string
+	fields map[string]interface{}
+}
+
+type recordingLogger struct {
+	sync.Mutex
+	records []logRecord
+}
+
+func (l *recordingLogger) record(level string, msg string, keysAndValues []interface{}) {
+	l.Lock()
+	defer l.Unlock()
+	l.records = append(l.records, logRecord{level, msg, logFields(keysAndValues)})
+}
+func (l *recordingLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.record("debug", msg, keysAndValues)
+}
+func (l *recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.record("info", msg, keysAndValues)
+}
+func (l *recordingLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.record("warn", msg, keysAndValues)
+}
+func (l *recordingLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.record("error", msg, keysAndValues)
+}
+func (l *recordingLogger) recordsOf(level string) []logRecord {
+	l.Lock()
+	defer l.Unlock()
+	var records []logRecord
+	for _, record := range l.records {
+		if record.level == level {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
 func getResponseByTid(responses []*response, tid int) *response {
 	resp, _, _ := From(responses).FirstBy(func(x T) (bool, error) {
 		return x.(*response).Tid == tid, nil
@@ -240,7 +677,7 @@ func TestExtDirect(t *testing.T) {
 		provider.Debug(providerDebug)
 		provider.Profile(providerProfile)
 		provider.RegisterAction(reflect.TypeOf(Db{}))
-		reqs := mustDecodeTransaction(strings.NewReader(`{"action":"Db","method":"test","data":null,"type":"rpc","tid":1}`))
+		reqs := provider.mustDecodeTransaction(strings.NewReader(`{"action":"Db","method":"test","data":null,"type":"rpc","tid":1}`))
 		Convey("has one parsed request with correct fields", func() {
 			So(len(reqs), ShouldEqual, 1)
 			So(reqs[0].Action, ShouldEqual, "Db")
@@ -272,7 +709,7 @@ func TestExtDirect(t *testing.T) {
 		provider.Debug(providerDebug)
 		provider.Profile(providerProfile)
 		provider.RegisterAction(reflect.TypeOf(Db{}))
-		reqs := mustDecodeTransaction(strings.NewReader(`[{"action":"Db","method":"testEcho1","data":["Hello!"],"type":"rpc","tid":1},{"action":"Db","method":"testEcho2","data":["Hello", 1, 2, 3, 4, null, null],"type":"rpc","tid":2}]`))
+		reqs := provider.mustDecodeTransaction(strings.NewReader(`[{"action":"Db","method":"testEcho1","data":["Hello!"],"type":"rpc","tid":1},{"action":"Db","method":"testEcho2","data":["Hello", 1, 2, 3, 4, null, null],"type":"rpc","tid":2}]`))
 		Convey("has 2 parsed requests with correct fields", func() {
 			So(len(reqs), ShouldEqual, 2)
 			So(reqs[0].Action, ShouldEqual, "Db")
@@ -324,7 +761,7 @@ func TestExtDirect(t *testing.T) {
 		provider.Debug(providerDebug)
 		provider.Profile(providerProfile)
 		provider.RegisterAction(reflect.TypeOf(Db{}))
-		reqs := mustDecodeTransaction(strings.NewReader(`[{"action":"Db","method":"testException1","data":null,"type":"rpc","tid":1},{"action":"Db","method":"testException2","data":null,"type":"rpc","tid":2},{"action":"Db","method":"testException3","data":null,"type":"rpc","tid":3},{"action":"Db","method":"testException4","data":null,"type":"rpc","tid":4}]`))
+		reqs := provider.mustDecodeTransaction(strings.NewReader(`[{"action":"Db","method":"testException1","data":null,"type":"rpc","tid":1},{"action":"Db","method":"testException2","data":null,"type":"rpc","tid":2},{"action":"Db","method":"testException3","data":null,"type":"rpc","tid":3},{"action":"Db","method":"testException4","data":null,"type":"rpc","tid":4}]`))
 		Convey("processed with 4 responses", func() {
 			resps := provider.processRequests(nil, nil, reqs)
 			So(len(resps), ShouldEqual, 4)
@@ -351,7 +788,7 @@ func TestExtDirect(t *testing.T) {
 		provider.Debug(providerDebug)
 		provider.Profile(providerProfile)
 		provider.RegisterAction(reflect.TypeOf(Db{}))
-		reqs := mustDecodeTransaction(strings.NewReader(`{"action":"Db","method":"getRecords","data":[{"page":1,"start":0,"limit":25,"sort":[{"property":"text","direction":"ASC"}]}],"type":"rpc","tid":1}`))
+		reqs := provider.mustDecodeTransaction(strings.NewReader(`{"action":"Db","method":"getRecords","data":[{"page":1,"start":0,"limit":25,"sort":[{"property":"text","direction":"ASC"}]}],"type":"rpc","tid":1}`))
 		Convey("processed with correct result", func() {
 			resps := provider.processRequests(nil, nil, reqs)
 			So(len(resps), ShouldEqual, 1)
@@ -366,7 +803,7 @@ func TestExtDirect(t *testing.T) {
 		provider.Debug(providerDebug)
 		provider.Profile(providerProfile)
 		provider.RegisterAction(reflect.TypeOf(Db{}))
-		reqs := mustDecodeTransaction(strings.NewReader(`{"action":"Db","method":"testTime","data":[{"timestamp":"2009-11-10T23:00:00Z"}],"type":"rpc","tid":1}`))
+		reqs := provider.mustDecodeTransaction(strings.NewReader(`{"action":"Db","method":"testTime","data":[{"timestamp":"2009-11-10T23:00:00Z"}],"type":"rpc","tid":1}`))
 		Convey("processed with correct result", func() {
 			resps := provider.processRequests(nil, nil, reqs)
 			So(len(resps), ShouldEqual, 1)
@@ -384,7 +821,7 @@ func TestExtDirect(t *testing.T) {
 		provider.Debug(providerDebug)
 		provider.Profile(providerProfile)
 		provider.RegisterAction(reflect.TypeOf(Db{}))
-		reqs := mustDecodeTransaction(strings.NewReader(`{"action":"Db","method":"test","data":null,"type":"rpc","tid":1}`))
+		reqs := provider.mustDecodeTransaction(strings.NewReader(`{"action":"Db","method":"test","data":null,"type":"rpc","tid":1}`))
 		resps := provider.processRequests(gcontext.Set(&web.C{
 			URLParams:map[string]string{"test":"test1"},
 			Env: map[interface{}]interface{}{
@@ -523,4 +960,1346 @@ func TestExtDirect(t *testing.T) {
 			})
 		})
 	})
+	Convey("Zero and nil results encoding", t, func() {
+		provider := NewProvider()
+		provider.Debug(providerDebug)
+		provider.Profile(providerProfile)
+		provider.RegisterAction(reflect.TypeOf(Results{}))
+		reqs := provider.mustDecodeTransaction(strings.NewReader(`[{"action":"Results","method":"false","data":null,"type":"rpc","tid":1},{"action":"Results","method":"zero","data":null,"type":"rpc","tid":2},{"action":"Results","method":"emptyString","data":null,"type":"rpc","tid":3},{"action":"Results","method":"nilSlice","data":null,"type":"rpc","tid":4},{"action":"Results","method":"nilMap","data":null,"type":"rpc","tid":5},{"action":"Results","method":"nilSliceInterface","data":null,"type":"rpc","tid":6},{"action":"Results","method":"void","data":null,"type":"rpc","tid":7}]`))
+		encode := func(resps []*response, tid int) string {
+			s, err := json.Marshal(getResponseByTid(resps, tid))
+			So(err, ShouldBeNil)
+			return string(s)
+		}
+
+		Convey("always includes result", func() {
+			resps := provider.processRequests(nil, nil, reqs)
+			So(len(resps), ShouldEqual, 7)
+			So(encode(resps, 1), ShouldEqual, `{"type":"rpc","tid":1,"action":"Results","method":"false","result":false}`)
+			So(encode(resps, 2), ShouldEqual, `{"type":"rpc","tid":2,"action":"Results","method":"zero","result":0}`)
+			So(encode(resps, 3), ShouldEqual, `{"type":"rpc","tid":3,"action":"Results","method":"emptyString","result":""}`)
+			So(encode(resps, 4), ShouldEqual, `{"type":"rpc","tid":4,"action":"Results","method":"nilSlice","result":null}`)
+			So(encode(resps, 5), ShouldEqual, `{"type":"rpc","tid":5,"action":"Results","method":"nilMap","result":null}`)
+			So(encode(resps, 6), ShouldEqual, `{"type":"rpc","tid":6,"action":"Results","method":"nilSliceInterface","result":null}`)
+			So(encode(resps, 7), ShouldEqual, `{"type":"rpc","tid":7,"action":"Results","method":"void","result":null}`)
+		})
+
+		Convey("encodes nil collections as empty ones if enabled", func() {
+			provider.EmptyCollections(true)
+			resps := provider.processRequests(nil, nil, reqs)
+			So(len(resps), ShouldEqual, 7)
+			So(encode(resps, 4), ShouldEqual, `{"type":"rpc","tid":4,"action":"Results","method":"nilSlice","result":[]}`)
+			So(encode(resps, 5), ShouldEqual, `{"type":"rpc","tid":5,"action":"Results","method":"nilMap","result":{}}`)
+			So(encode(resps, 6), ShouldEqual, `{"type":"rpc","tid":6,"action":"Results","method":"nilSliceInterface","result":[]}`)
+			So(encode(resps, 7), ShouldEqual, `{"type":"rpc","tid":7,"action":"Results","method":"void","result":null}`)
+		})
+	})
+
+	Convey("Custom codec", t, func() {
+		provider := NewProvider()
+		provider.Debug(providerDebug)
+		provider.Profile(providerProfile)
+		provider.RegisterAction(reflect.TypeOf(Db{}))
+		codec := &countingCodec{}
+		provider.SetCodec(codec)
+
+		Convey("is used to decode requests and encode responses", func() {
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest("POST", provider.URL, strings.NewReader(`[{"action":"Db","method":"testEcho1","data":["Hello!"],"type":"rpc","tid":1},{"action":"Db","method":"testException1","data":null,"type":"rpc","tid":2}]`))
+			So(err, ShouldBeNil)
+			r.Header.Set("Content-Type", "application/json")
+			ActionsHandler(provider)(w, r)
+			So(codec.marshalled, ShouldEqual, 1)
+			// Transaction, arguments arrays of both calls and single argument of testEcho1.
+			So(codec.unmarshalled, ShouldEqual, 4)
+			So(w.Body.String(), ShouldContainSubstring, `{"type":"rpc","tid":1,"action":"Db","method":"testEcho1","result":"Hello!"}`)
+			So(w.Body.String(), ShouldContainSubstring, `{"type":"exception","tid":2,"action":"Db","method":"testException1","message":"Error example #1"}`)
+		})
+	})
+
+	Convey("Streaming responses", t, func() {
+		provider := NewProvider()
+		provider.Debug(providerDebug)
+		provider.Profile(providerProfile)
+		provider.Stream(true)
+		provider.RegisterAction(reflect.TypeOf(Db{}))
+		srv := httptest.NewServer(http.HandlerFunc(ActionsHandler(provider)))
+		defer srv.Close()
+
+		Convey("are written in order of requests with chunked transfer", func() {
+			res, err := http.Post(srv.URL, "application/json", strings.NewReader(`[{"action":"Db","method":"testEcho1","data":["Hello!"],"type":"rpc","tid":1},{"action":"Db","method":"testException1","data":null,"type":"rpc","tid":2},{"action":"Db","method":"testEcho2","data":["Hello", 1, 2, 3, 4, null, null],"type":"rpc","tid":3}]`))
+			So(err, ShouldBeNil)
+			So(res.Header.Get("Content-Type"), ShouldEqual, "application/json; charset=utf-8")
+			So(res.TransferEncoding, ShouldResemble, []string{"chunked"})
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			So(err, ShouldBeNil)
+			So(string(body), ShouldEqual, `[{"type":"rpc","tid":1,"action":"Db","method":"testEcho1","result":"Hello!"},{"type":"exception","tid":2,"action":"Db","method":"testException1","message":"Error example #1"},{"type":"rpc","tid":3,"action":"Db","method":"testEcho2","result":"Hello12340"}]` + "\n")
+		})
+	})
+
+	Convey("Response compression", t, func() {
+		provider := NewProvider()
+		provider.Debug(providerDebug)
+		provider.Profile(providerProfile)
+		provider.RegisterAction(reflect.TypeOf(Db{}))
+		provider.Compress(0)
+		apiJavaScript, _ := provider.JavaScript()
+		request := func(acceptEncoding string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest("POST", provider.URL, strings.NewReader(`{"action":"Db","method":"testEcho1","data":["Hello!"],"type":"rpc","tid":1}`))
+			So(err, ShouldBeNil)
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+			ActionsHandler(provider)(w, r)
+			return w
+		}
+		expectedBody := `[{"type":"rpc","tid":1,"action":"Db","method":"testEcho1","result":"Hello!"}]` + "\n"
+
+		Convey("of API script with gzip", func() {
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest("GET", provider.URL, nil)
+			So(err, ShouldBeNil)
+			r.Header.Set("Accept-Encoding", "gzip, deflate")
+			API(provider)(w, r)
+			So(w.Header().Get("Content-Encoding"), ShouldEqual, "gzip")
+			So(w.Header().Get("Vary"), ShouldEqual, "Accept-Encoding")
+			gr, err := gzip.NewReader(w.Body)
+			So(err, ShouldBeNil)
+			body, err := ioutil.ReadAll(gr)
+			So(err, ShouldBeNil)
+			So(string(body), ShouldEqual, apiJavaScript)
+		})
+
+		Convey("of transaction with deflate preferred by client", func() {
+			w := request("gzip;q=0.5, deflate")
+			So(w.Header().Get("Content-Encoding"), ShouldEqual, "deflate")
+			zr, err := zlib.NewReader(w.Body)
+			So(err, ShouldBeNil)
+			body, err := ioutil.ReadAll(zr)
+			So(err, ShouldBeNil)
+			So(string(body), ShouldEqual, expectedBody)
+		})
+
+		Convey("of transaction with registered compressor", func() {
+			provider.RegisterCompressor("x-test", GzipCompressor)
+			w := request("gzip, x-test")
+			So(w.Header().Get("Content-Encoding"), ShouldEqual, "x-test")
+		})
+
+		Convey("is not applied to encodings not accepted by client", func() {
+			w := request("br, gzip;q=0")
+			So(w.Header().Get("Content-Encoding"), ShouldBeEmpty)
+			So(w.Body.String(), ShouldEqual, expectedBody)
+		})
+
+		Convey("is not applied to responses below threshold", func() {
+			provider.Compress(1024)
+			w := request("gzip")
+			So(w.Header().Get("Content-Encoding"), ShouldBeEmpty)
+			So(w.Header().Get("Vary"), ShouldEqual, "Accept-Encoding")
+			So(w.Body.String(), ShouldEqual, expectedBody)
+		})
+
+		Convey("is not applied if disabled", func() {
+			provider.Compress(-1)
+			w := request("gzip")
+			So(w.Header().Get("Content-Encoding"), ShouldBeEmpty)
+			So(w.Header().Get("Vary"), ShouldBeEmpty)
+			So(w.Body.String(), ShouldEqual, expectedBody)
+		})
+	})
+
+	Convey("Provider as HTTP handler", t, func() {
+		provider := NewProvider()
+		provider.Debug(providerDebug)
+		provider.Profile(providerProfile)
+		provider.RegisterAction(reflect.TypeOf(Db{}))
+		mux := http.NewServeMux()
+		provider.Mount(mux)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mux.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "user", "TestUser")))
+		}))
+		defer srv.Close()
+
+		Convey("serves API script on GET", func() {
+			res, err := http.Get(srv.URL + provider.URL)
+			So(err, ShouldBeNil)
+			So(res.Header.Get("Content-Type"), ShouldEqual, "text/javascript; charset=utf-8")
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			So(err, ShouldBeNil)
+			javaScript, _ := provider.JavaScript()
+			So(string(body), ShouldEqual, javaScript)
+		})
+
+		Convey("handles transaction with request context on POST", func() {
+			res, err := http.Post(srv.URL + provider.URL, "application/json", strings.NewReader(`{"action":"Db","method":"test","data":null,"type":"rpc","tid":33}`))
+			So(err, ShouldBeNil)
+			So(res.Header.Get("Content-Type"), ShouldEqual, "application/json; charset=utf-8")
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			So(err, ShouldBeNil)
+			So(MatchesRegexp(`\[{"type":"rpc","tid":33,"action":"Db","method":"test","result":"TestUser127\.0\.0\.1:\d+"}]`).Matches(string(body)), ShouldBeNil)
+		})
+
+		Convey("rejects other methods", func() {
+			req, err := http.NewRequest("PUT", srv.URL + provider.URL, nil)
+			So(err, ShouldBeNil)
+			res, err := http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+			res.Body.Close()
+			So(res.StatusCode, ShouldEqual, http.StatusMethodNotAllowed)
+			So(res.Header.Get("Allow"), ShouldEqual, "GET, HEAD, POST")
+		})
+
+		Convey("is mounted in router with other Handle signature by RouterFunc", func() {
+			mux := routeMux{http.NewServeMux()}
+			provider.Mount(RouterFunc(func(pattern string, handler http.Handler) {
+				mux.Handle(pattern, handler)
+			}))
+			r := httptest.NewRequest("POST", provider.URL, strings.NewReader(`{"action":"Db","method":"testEcho1","data":["a"],"type":"rpc","tid":1}`))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			So(w.Body.String(), ShouldStartWith, `[{"type":"rpc","tid":1,"action":"Db","method":"testEcho1","result":"a"}]`)
+		})
+
+		Convey("is mounted in method router by MountMethods", func() {
+			mux := methodMux{}
+			provider.MountMethods(mux)
+			So(mux, ShouldContainKey, "GET /directapi")
+			So(mux, ShouldContainKey, "HEAD /directapi")
+			So(mux, ShouldNotContainKey, "PUT /directapi")
+			r := httptest.NewRequest("POST", provider.URL, strings.NewReader(`{"action":"Db","method":"testEcho1","data":["a"],"type":"rpc","tid":1}`))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			So(w.Body.String(), ShouldStartWith, `[{"type":"rpc","tid":1,"action":"Db","method":"testEcho1","result":"a"}]`)
+		})
+	})
+
+	Convey("Provider logger", t, func() {
+		provider := NewProvider()
+		logger := &recordingLogger{}
+		provider.SetLogger(logger)
+		provider.Profile(true)
+		provider.RegisterAction(reflect.TypeOf(Db{}))
+		reqs := provider.mustDecodeTransaction(strings.NewReader(`[{"action":"Db","method":"testEcho1","data":["Hello!"],"type":"rpc","tid":1},{"action":"Db","method":"testException2","data":null,"type":"rpc","tid":2}]`))
+		provider.processRequests(nil, nil, reqs)
+
+		Convey("receives no debug records unless debugging is enabled", func() {
+			So(logger.recordsOf("debug"), ShouldBeEmpty)
+		})
+
+		Convey("receives profiling records with fields", func() {
+			records := logger.recordsOf("info")
+			So(len(records), ShouldEqual, 2)
+			for _, record := range records {
+				So(record.fields["action"], ShouldEqual, "Db")
+				So(record.fields, ShouldContainKey, "method")
+				So(record.fields, ShouldContainKey, "duration")
+			}
+		})
+
+		Convey("receives error records with fields", func() {
+			records := logger.recordsOf("error")
+			So(len(records), ShouldEqual, 1)
+			So(records[0].msg, ShouldContainSubstring, "Error example #2")
+			So(records[0].fields["action"], ShouldEqual, "Db")
+			So(records[0].fields["method"], ShouldEqual, "testException2")
+			So(records[0].fields["error"], ShouldHaveSameTypeAs, ErrDirectActionMethod{})
+		})
+	})
+
+	Convey("Logger adapters", t, func() {
+		buf := &bytes.Buffer{}
+
+		Convey("standard library logger", func() {
+			l := &StdLogger{stdlog.New(buf, "", 0)}
+			l.Warn("message", "action", "Db", "method", "test")
+			So(buf.String(), ShouldEqual, "warn: message action=Db method=test\n")
+		})
+
+		Convey("slog logger", func() {
+			l := &SlogLogger{slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))}
+			l.Debug("message", "action", "Db")
+			So(buf.String(), ShouldContainSubstring, `level=DEBUG msg=message action=Db`)
+		})
+
+		Convey("logrus logger", func() {
+			logrusLogger := logrus.New()
+			logrusLogger.Out = buf
+			logrusLogger.Formatter = &logrus.TextFormatter{DisableTimestamp: true, DisableColors: true}
+			l := &LogrusLogger{logrus.NewEntry(logrusLogger)}
+			l.Error("message", "action", "Db", "error", errors.New("test"))
+			So(buf.String(), ShouldContainSubstring, `level=error msg=message action=Db error=test stack=`)
+		})
+	})
+
+	Convey("Metrics", t, func() {
+		provider := NewProvider()
+		provider.Debug(providerDebug)
+		provider.Profile(providerProfile)
+		provider.RegisterAction(reflect.TypeOf(Db{}))
+		metrics := NewPrometheusMetrics()
+		metrics.DurationBuckets = []float64{1}
+		metrics.BatchSizeBuckets = []float64{1, 5}
+		provider.SetMetrics(metrics)
+		provider.processRequests(nil, nil, provider.mustDecodeTransaction(strings.NewReader(`[{"action":"Db","method":"testEcho1","data":["Hello!"],"type":"rpc","tid":1},{"action":"Db","method":"testEcho1","data":["Hello!"],"type":"rpc","tid":2},{"action":"Db","method":"testException1","data":null,"type":"rpc","tid":3},{"action":"Db","method":"testException2","data":null,"type":"rpc","tid":4},{"action":"Db","method":"unknown","data":null,"type":"rpc","tid":5}]`)))
+		provider.processRequests(nil, nil, provider.mustDecodeTransaction(strings.NewReader(`{"action":"Db","method":"testEcho1","data":["Hello!"],"type":"rpc","tid":6}`)))
+
+		Convey("are exposed in Prometheus text format", func() {
+			w := httptest.NewRecorder()
+			metrics.ServeHTTP(w, nil)
+			So(w.Header().Get("Content-Type"), ShouldEqual, "text/plain; version=0.0.4; charset=utf-8")
+			So(w.Body.String(), ShouldEqual, `# HELP extdirect_calls_total Total number of direct method calls by status.
+# TYPE extdirect_calls_total counter
+extdirect_calls_total{action="Db",method="testEcho1",status="success"} 3
+extdirect_calls_total{action="Db",method="testException1",status="panic"} 1
+extdirect_calls_total{action="Db",method="testException2",status="error"} 1
+# HELP extdirect_calls_in_flight Number of direct method calls being processed.
+# TYPE extdirect_calls_in_flight gauge
+extdirect_calls_in_flight{action="Db",method="testEcho1"} 0
+extdirect_calls_in_flight{action="Db",method="testException1"} 0
+extdirect_calls_in_flight{action="Db",method="testException2"} 0
+# HELP extdirect_call_duration_seconds Latency of direct method calls.
+# TYPE extdirect_call_duration_seconds histogram
+extdirect_call_duration_seconds_bucket{action="Db",method="testEcho1",le="1"} 3
+extdirect_call_duration_seconds_bucket{action="Db",method="testEcho1",le="+Inf"} 3
+extdirect_call_duration_seconds_sum{action="Db",method="testEcho1"} ` + formatFloat(metrics.durations[methodKey{"Db", "testEcho1"}].sum) + `
+extdirect_call_duration_seconds_count{action="Db",method="testEcho1"} 3
+extdirect_call_duration_seconds_bucket{action="Db",method="testException1",le="1"} 1
+extdirect_call_duration_seconds_bucket{action="Db",method="testException1",le="+Inf"} 1
+extdirect_call_duration_seconds_sum{action="Db",method="testException1"} ` + formatFloat(metrics.durations[methodKey{"Db", "testException1"}].sum) + `
+extdirect_call_duration_seconds_count{action="Db",method="testException1"} 1
+extdirect_call_duration_seconds_bucket{action="Db",method="testException2",le="1"} 1
+extdirect_call_duration_seconds_bucket{action="Db",method="testException2",le="+Inf"} 1
+extdirect_call_duration_seconds_sum{action="Db",method="testException2"} ` + formatFloat(metrics.durations[methodKey{"Db", "testException2"}].sum) + `
+extdirect_call_duration_seconds_count{action="Db",method="testException2"} 1
+# HELP extdirect_batch_size Number of direct method calls per transaction.
+# TYPE extdirect_batch_size histogram
+extdirect_batch_size_bucket{le="1"} 1
+extdirect_batch_size_bucket{le="5"} 2
+extdirect_batch_size_bucket{le="+Inf"} 2
+extdirect_batch_size_sum 6
+extdirect_batch_size_count 2
+`)
+		})
+	})
+
+	Convey("Audit", t, func() {
+		provider := NewProvider()
+		provider.Debug(providerDebug)
+		provider.Profile(providerProfile)
+		provider.RegisterAction(reflect.TypeOf(Accounts{}))
+		auditor := &recordingAuditor{}
+		provider.SetAuditor(auditor)
+		provider.SetUserFunc(func(c context.Context, r *http.Request) string {
+			return r.Header.Get("X-User")
+		})
+		reqs := provider.mustDecodeTransaction(strings.NewReader(`[{"action":"Accounts","method":"signIn","data":[{"login":"bob","password":"secret","Token":"abc"},true],"type":"rpc","tid":1},{"action":"Accounts","method":"signIn","data":[{"login":"bob","password":"wrong"},false],"type":"rpc","tid":2},{"action":"Accounts","method":"setSecret","data":["secret"],"type":"rpc","tid":3}]`))
+		provider.processRequests(nil, &http.Request{Header: http.Header{"X-User": []string{"admin"}}}, reqs)
+
+		Convey("records successful call with redacted fields", func() {
+			record := auditor.record(1)
+			So(record, ShouldNotBeNil)
+			So(record.User, ShouldEqual, "admin")
+			So(record.Action, ShouldEqual, "Accounts")
+			So(record.Method, ShouldEqual, "signIn")
+			So(record.Status, ShouldEqual, CallSuccess)
+			So(record.Err, ShouldBeNil)
+			So(record.Duration, ShouldBeGreaterThan, 0)
+			So(record.Args, ShouldResemble, []interface{}{
+				map[string]interface{}{"login": "bob", "password": RedactedValue, "Token": RedactedValue},
+				true,
+			})
+		})
+
+		Convey("records failed call", func() {
+			record := auditor.record(2)
+			So(record, ShouldNotBeNil)
+			So(record.Status, ShouldEqual, CallError)
+			So(record.Err.Error(), ShouldContainSubstring, "invalid password")
+		})
+
+		Convey("records call of redacted method", func() {
+			record := auditor.record(3)
+			So(record, ShouldNotBeNil)
+			So(record.Args, ShouldResemble, []interface{}{RedactedValue})
+		})
+
+		Convey("records fields of embedded structs as encoded into JSON", func() {
+			So(redactValue(reflect.ValueOf(&Registration{Credentials{"bob", "secret", "abc"}, "bob@example.com"})), ShouldResemble, map[string]interface{}{
+				"login": "bob", "password": RedactedValue, "Token": RedactedValue, "email": "bob@example.com",
+			})
+		})
+
+		Convey("masks marshalers with redacted fields as a whole", func() {
+			So(redactValue(reflect.ValueOf(APIKey{"ci", "abc"})), ShouldEqual, RedactedValue)
+			So(redactValue(reflect.ValueOf(&struct{ Keys []APIKey }{[]APIKey{{"ci", "abc"}}})), ShouldResemble, map[string]interface{}{
+				"Keys": []interface{}{RedactedValue},
+			})
+			timestamp := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+			So(redactValue(reflect.ValueOf(timestamp)), ShouldResemble, timestamp)
+		})
+	})
+
+	Convey("TypeScript declarations", t, func() {
+		provider := NewProvider()
+		provider.Debug(providerDebug)
+		provider.Profile(providerProfile)
+		provider.RegisterAction(reflect.TypeOf(People{}))
+		provider.RegisterAction(reflect.TypeOf(Db{}))
+		So(provider.TypeScript(), ShouldStartWith, `declare namespace DirectApi {
+    interface DirectFormHandlerResult {
+        errors?: { [key: string]: string };
+        success: boolean;
+    }
+    interface FilterDescriptor {
+        Property: string;
+        Value: boolean;
+    }
+    interface GetDataRequest {
+        Page: number;
+        Start: number;
+        Limit: number;
+        Sort: SortDescriptor[];
+        Filter: FilterDescriptor[];
+        Model: string;
+    }
+    interface Person {
+        id: number;
+        name: string;
+        email?: string;
+        tags: string[];
+        born: string;
+        City: string;
+        "extra-data": { [key: string]: any };
+    }
+`)
+		So(provider.TypeScript(), ShouldContainSubstring, `
+    namespace Db {
+        function getRecords(arg0: GetDataRequest, callback?: (result: string, event: any) => void, scope?: any): void;
+        function test(callback?: (result: string, event: any) => void, scope?: any): void;
+`)
+		So(provider.TypeScript(), ShouldContainSubstring, `
+        function testEcho2(arg0: string, arg1: number, arg2: number, arg3: number, arg4: number, arg5: number, arg6: string, callback?: (result: string, event: any) => void, scope?: any): void;
+        function testException1(callback?: (result: null, event: any) => void, scope?: any): void;
+        function testException2(callback?: (result: null, event: any) => void, scope?: any): void;
+`)
+		So(provider.TypeScript(), ShouldEndWith, `
+        function updateBasicInfo(form: any, callback?: (result: DirectFormHandlerResult, event: any) => void, scope?: any): void;
+    }
+    namespace People {
+        function getPeople(arg0: { [key: string]: string }, arg1: number, callback?: (result: Person[], event: any) => void, scope?: any): void;
+        function ping(callback?: (result: null, event: any) => void, scope?: any): void;
+        function remove(arg0: number[], callback?: (result: boolean, event: any) => void, scope?: any): void;
+        function save(arg0: Person, callback?: (result: boolean, event: any) => void, scope?: any): void;
+    }
+}
+`)
+	})
+
+	Convey("Ext JS model generation", t, func() {
+		provider := NewProvider()
+		provider.Debug(providerDebug)
+		provider.Profile(providerProfile)
+		provider.RegisterAction(reflect.TypeOf(People{}))
+		provider.RegisterAction(reflect.TypeOf(Db{}))
+
+		Convey("with record type inferred from read method", func() {
+			js, err := provider.ExtModel(ExtModelConfig{
+				Model: "App.model.Person",
+				Store: "App.store.People",
+				Action: "People",
+				Read: "getPeople",
+				Update: "save",
+				Destroy: "remove",
+			})
+			So(err, ShouldBeNil)
+			So(js, ShouldEqual, `Ext.define("App.model.Person", {
+    extend: "Ext.data.Model",
+    idProperty: "id",
+    fields: [
+        {name: "id", type: "int"},
+        {name: "name", type: "string"},
+        {name: "email", type: "string", allowNull: true},
+        {name: "tags", type: "auto"},
+        {name: "born", type: "date", dateFormat: "c"},
+        {name: "City", type: "string"},
+        {name: "extra-data", type: "auto"}
+    ],
+    proxy: {
+        type: "direct",
+        api: {
+            read: "DirectApi.People.getPeople",
+            update: "DirectApi.People.save",
+            destroy: "DirectApi.People.remove"
+        }
+    }
+});
+Ext.define("App.store.People", {
+    extend: "Ext.data.Store",
+    model: "App.model.Person"
+});
+`)
+		})
+
+		Convey("with record type inferred from root property of read method result", func() {
+			js, err := provider.ExtModel(ExtModelConfig{
+				Model: "App.model.Sort",
+				Action: "Db",
+				Read: "getRecords",
+				Record: reflect.TypeOf(SortDescriptor{}),
+				RootProperty: "records",
+				TotalProperty: "total",
+			})
+			So(err, ShouldBeNil)
+			So(js, ShouldContainSubstring, `
+    fields: [
+        {name: "Property", type: "string"},
+        {name: "Direction", type: "string"}
+    ],`)
+			So(js, ShouldEndWith, `
+        reader: {
+            type: "json",
+            rootProperty: "records",
+            totalProperty: "total"
+        }
+    }
+});
+`)
+		})
+
+		Convey("fails for unknown method", func() {
+			_, err := provider.ExtModel(ExtModelConfig{Model: "App.model.Person", Action: "People", Read: "unknown"})
+			So(err, ShouldResemble, ErrUnknownMethod{"People", "unknown"})
+		})
+
+		Convey("fails without record type and read method", func() {
+			_, err := provider.ExtModel(ExtModelConfig{Model: "App.model.Person", Action: "People", Create: "save"})
+			So(err, ShouldResemble, ErrNoReadMethod("People"))
+			So(err.Error(), ShouldEqual, "cannot infer record type of People without read method, set Record or Read of model config")
+		})
+
+		Convey("fails if record type cannot be inferred", func() {
+			_, err := provider.ExtModel(ExtModelConfig{Model: "App.model.Record", Action: "Db", Read: "getRecords"})
+			So(err, ShouldResemble, ErrRecordTypeUnknown("Db.getRecords"))
+		})
+	})
+
+	Convey("CRUD action", t, func() {
+		provider := NewProvider()
+		provider.Debug(providerDebug)
+		provider.Profile(providerProfile)
+		provider.RegisterAction(reflect.TypeOf(Users{}))
+		provider.RegisterAction(reflect.TypeOf(Db{}))
+
+		Convey("is advertised with direct proxy config", func() {
+			js, err := provider.JavaScript()
+			So(err, ShouldBeNil)
+			So(js, ShouldEndWith, `;DirectApi.PROXIES={"Users":{"type":"direct","api":{"create":"DirectApi.Users.create","destroy":"DirectApi.Users.destroy","read":"DirectApi.Users.read","update":"DirectApi.Users.update"},"reader":{"messageProperty":"message","rootProperty":"records","successProperty":"success","totalProperty":"total","type":"json"},"writer":{"allowSingle":false,"clientIdProperty":"clientId","type":"json"}}}`)
+		})
+
+		Convey("reads records with sorters, filters and grouper", func() {
+			reqs := provider.mustDecodeTransaction(strings.NewReader(`{"action":"Users","method":"read","data":[{"page":1,"start":0,"limit":25,"sort":[{"property":"name","direction":"ASC"}],"filter":[{"property":"id","value":5,"operator":"gt"}],"group":{"property":"name","direction":"DESC"}}],"type":"rpc","tid":1}`))
+			resps := provider.processRequests(nil, nil, reqs)
+			So(resps[0].Message, ShouldBeNil)
+			s, err := json.Marshal(resps[0].Result)
+			So(err, ShouldBeNil)
+			So(string(s), ShouldEqual, `{"total":1,"records":[{"id":1,"name":"[{name ASC}] [{id 5 gt}] [{name DESC}]"}],"success":true}`)
+		})
+
+		Convey("creates records mapping client ids to server ids", func() {
+			reqs := provider.mustDecodeTransaction(strings.NewReader(`{"action":"Users","method":"create","data":[[{"clientId":"ext-1","name":"Bob"},{"clientId":"ext-2","name":"Alice"}]],"type":"rpc","tid":1}`))
+			resps := provider.processRequests(nil, nil, reqs)
+			So(resps[0].Message, ShouldBeNil)
+			s, err := json.Marshal(resps[0].Result)
+			So(err, ShouldBeNil)
+			So(string(s), ShouldEqual, `{"total":2,"records":[{"clientId":"ext-1","id":10,"name":"Bob"},{"clientId":"ext-2","id":11,"name":"Alice"}],"success":true}`)
+			usersStore.Lock()
+			defer usersStore.Unlock()
+			So(usersStore.users, ShouldHaveLength, 2)
+			delete(usersStore.users, 10)
+			delete(usersStore.users, 11)
+		})
+
+		Convey("rolls back partially failed batch reporting per-record errors", func() {
+			reqs := provider.mustDecodeTransaction(strings.NewReader(`{"action":"Users","method":"create","data":[[{"clientId":"ext-1","name":"Bob"},{"clientId":"ext-2","name":""},{"clientId":"ext-3","name":"Alice"}]],"type":"rpc","tid":1}`))
+			resps := provider.processRequests(nil, nil, reqs)
+			So(resps[0].Message, ShouldBeNil)
+			s, err := json.Marshal(resps[0].Result)
+			So(err, ShouldBeNil)
+			So(string(s), ShouldEqual, `{"total":0,"records":[],"success":false,"message":"name is required","errors":[{"index":1,"clientId":"ext-2","message":"name is required"}]}`)
+			usersStore.Lock()
+			defer usersStore.Unlock()
+			So(usersStore.users, ShouldBeEmpty)
+		})
+	})
+
+	Convey("WebSocket transport", t, func() {
+		provider := NewProvider()
+		provider.RegisterAction(reflect.TypeOf(Db{}))
+		provider.SetWebSocketURL("/directapi/ws")
+		provider.SetUserFunc(func(c context.Context, r *http.Request) string {
+			return r.URL.Query().Get("user")
+		})
+		mux := http.NewServeMux()
+		provider.Mount(mux)
+		server := httptest.NewServer(mux)
+		defer server.Close()
+		dial := func(user string) *websocket.Conn {
+			ws, err := websocket.Dial("ws" + strings.TrimPrefix(server.URL, "http") + "/directapi/ws?user=" + user, "", server.URL)
+			So(err, ShouldBeNil)
+			return ws
+		}
+		receive := func(ws *websocket.Conn) string {
+			var message string
+			ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+			So(websocket.Message.Receive(ws, &message), ShouldBeNil)
+			return message
+		}
+		// subscribed waits until subscription sent before it is processed by sending request after it.
+		subscribed := func(ws *websocket.Conn, topic string) {
+			So(websocket.Message.Send(ws, `{"type":"subscribe","topics":["` + topic + `"]}`), ShouldBeNil)
+			So(websocket.Message.Send(ws, `{"action":"Db","method":"test","data":null,"type":"rpc","tid":100}`), ShouldBeNil)
+			So(receive(ws), ShouldContainSubstring, `"tid":100`)
+		}
+
+		Convey("is advertised with companion provider", func() {
+			js, err := provider.JavaScript()
+			So(err, ShouldBeNil)
+			So(js, ShouldContainSubstring, `;Ext.define("DirectApi.WebSocketProvider",{extend:"Ext.direct.RemotingProvider",alias:"direct.websocketprovider",`)
+			So(js, ShouldEndWith, `;DirectApi.WEBSOCKET_API=Ext.apply(Ext.apply({},DirectApi.REMOTE_API),{type:"websocketprovider",wsUrl:"/directapi/ws"})`)
+		})
+
+		Convey("processes transactions", func() {
+			ws := dial("alice")
+			defer ws.Close()
+			So(websocket.Message.Send(ws, `[{"action":"Db","method":"testEcho1","data":["hello"],"type":"rpc","tid":1},{"action":"Db","method":"testException2","data":null,"type":"rpc","tid":2}]`), ShouldBeNil)
+			So(receive(ws), ShouldEqual, `[{"type":"rpc","tid":1,"action":"Db","method":"testEcho1","result":"hello"},{"type":"exception","tid":2,"action":"Db","method":"testException2","message":"Error example #2"}]`)
+		})
+
+		Convey("pushes events to all, topic subscribers and user", func() {
+			alice := dial("alice")
+			defer alice.Close()
+			bob := dial("bob")
+			defer bob.Close()
+			subscribed(alice, "news")
+			subscribed(bob, "sports")
+
+			So(provider.Push("hello", 1), ShouldBeNil)
+			So(receive(alice), ShouldEqual, `{"type":"event","name":"hello","data":1}`)
+			So(receive(bob), ShouldEqual, `{"type":"event","name":"hello","data":1}`)
+
+			So(provider.PushTopic("news", "headline", "extra"), ShouldBeNil)
+			So(provider.PushUser("bob", "private", "msg"), ShouldBeNil)
+			So(receive(alice), ShouldEqual, `{"type":"event","name":"headline","data":"extra"}`)
+			So(receive(bob), ShouldEqual, `{"type":"event","name":"private","data":"msg"}`)
+		})
+
+		Convey("ignores subscriptions to unauthorized topics", func() {
+			provider.SetChannelAuthFunc(func(c context.Context, r *http.Request, topic string) bool {
+				return topic != "private"
+			})
+			alice := dial("alice")
+			defer alice.Close()
+			subscribed(alice, "private")
+			subscribed(alice, "news")
+			So(provider.PushTopic("private", "secret", 1), ShouldBeNil)
+			So(provider.PushTopic("news", "headline", 2), ShouldBeNil)
+			So(receive(alice), ShouldEqual, `{"type":"event","name":"headline","data":2}`)
+		})
+
+		Convey("rejects cross-origin handshake", func() {
+			dialFrom := func(origin string) error {
+				ws, err := websocket.Dial("ws" + strings.TrimPrefix(server.URL, "http") + "/directapi/ws", "", origin)
+				if err == nil {
+					ws.Close()
+				}
+				return err
+			}
+			So(dialFrom("https://evil.example.com"), ShouldNotBeNil)
+			So(dialFrom("https://app.example.com"), ShouldNotBeNil)
+			provider.SetWebSocketTrustedOrigins("https://app.example.com")
+			So(dialFrom("https://app.example.com"), ShouldBeNil)
+			So(dialFrom("https://evil.example.com"), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Server-Sent Events transport", t, func() {
+		provider := NewProvider()
+		provider.RegisterAction(reflect.TypeOf(Notifier{}))
+		provider.SetEventStreamURL("/directapi/events")
+		provider.SetEventStreamBuffer(2)
+		mux := http.NewServeMux()
+		provider.Mount(mux)
+		server := httptest.NewServer(mux)
+		defer server.Close()
+		subscribe := func(query string, lastEventID string) (*http.Response, *bufio.Reader) {
+			r, err := http.NewRequest("GET", server.URL + "/directapi/events" + query, nil)
+			So(err, ShouldBeNil)
+			if lastEventID != "" {
+				r.Header.Set("Last-Event-ID", lastEventID)
+			}
+			resp, err := http.DefaultClient.Do(r)
+			So(err, ShouldBeNil)
+			So(resp.Header.Get("Content-Type"), ShouldEqual, "text/event-stream")
+			return resp, bufio.NewReader(resp.Body)
+		}
+		receive := func(reader *bufio.Reader) string {
+			var message string
+			for {
+				line, err := reader.ReadString('\n')
+				So(err, ShouldBeNil)
+				if line == "\n" {
+					return message
+				}
+				message += line
+			}
+		}
+		// subscribed waits until subscriber is registered.
+		subscribed := func(count int) {
+			for {
+				provider.eventStream.mutex.Lock()
+				n := len(provider.eventStream.subs)
+				provider.eventStream.mutex.Unlock()
+				if n >= count {
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+
+		Convey("is advertised with companion provider", func() {
+			js, err := provider.JavaScript()
+			So(err, ShouldBeNil)
+			So(js, ShouldContainSubstring, `;Ext.define("DirectApi.EventSourceProvider",{extend:"Ext.direct.JsonProvider",alias:"direct.eventsourceprovider",`)
+			So(js, ShouldEndWith, `;DirectApi.EVENTSOURCE_API={type:"eventsourceprovider",url:"/directapi/events"}`)
+		})
+
+		Convey("streams events of subscribed channels published by actions", func() {
+			resp, reader := subscribe("?channel=news", "")
+			defer resp.Body.Close()
+			all, allReader := subscribe("", "")
+			defer all.Body.Close()
+			subscribed(2)
+			for _, data := range []string{`["sports","goal"]`, `["news","extra"]`} {
+				resps := provider.processRequests(nil, nil, provider.mustDecodeTransaction(strings.NewReader(`{"action":"Notifier","method":"notify","data":` + data + `,"type":"rpc","tid":1}`)))
+				So(resps[0].Message, ShouldBeNil)
+			}
+			So(receive(reader), ShouldEqual, "id: 2\ndata: {\"type\":\"event\",\"name\":\"notified\",\"data\":\"extra\"}\n")
+			So(receive(allReader), ShouldStartWith, "id: 1\n")
+			So(receive(allReader), ShouldStartWith, "id: 2\n")
+		})
+
+		Convey("resumes from buffer by Last-Event-ID", func() {
+			for i := 0; i < 4; i++ {
+				So(provider.Publish("news", "n", i), ShouldBeNil)
+			}
+			resp, reader := subscribe("?channel=news", "2")
+			defer resp.Body.Close()
+			So(receive(reader), ShouldEqual, "id: 3\ndata: {\"type\":\"event\",\"name\":\"n\",\"data\":2}\n")
+			So(receive(reader), ShouldEqual, "id: 4\ndata: {\"type\":\"event\",\"name\":\"n\",\"data\":3}\n")
+		})
+
+		Convey("sends heartbeats", func() {
+			provider.SetEventStreamHeartbeat(10 * time.Millisecond)
+			resp, reader := subscribe("", "")
+			defer resp.Body.Close()
+			So(receive(reader), ShouldEqual, ": heartbeat\n")
+		})
+
+		Convey("streams without heartbeats if they are disabled", func() {
+			provider.SetEventStreamHeartbeat(0)
+			resp, reader := subscribe("", "")
+			defer resp.Body.Close()
+			subscribed(1)
+			So(provider.Publish("news", "n", 1), ShouldBeNil)
+			So(receive(reader), ShouldStartWith, "id: 1\n")
+		})
+
+		Convey("streams authorized channels only", func() {
+			provider.SetChannelAuthFunc(func(c context.Context, r *http.Request, channel string) bool {
+				return channel != "private"
+			})
+			forbidden, err := http.Get(server.URL + "/directapi/events?channel=news&channel=private")
+			So(err, ShouldBeNil)
+			forbidden.Body.Close()
+			So(forbidden.StatusCode, ShouldEqual, http.StatusForbidden)
+
+			all, allReader := subscribe("", "")
+			defer all.Body.Close()
+			subscribed(1)
+			So(provider.Publish("private", "secret", 1), ShouldBeNil)
+			So(provider.Publish("news", "n", 2), ShouldBeNil)
+			So(receive(allReader), ShouldStartWith, "id: 2\n")
+		})
+	})
+
+	Convey("Events emitted by direct methods", t, func() {
+		provider := NewProvider()
+		provider.RegisterAction(reflect.TypeOf(Notifier{}))
+		post := func() string {
+			r, _ := http.NewRequest("POST", "/directapi", strings.NewReader(`[{"action":"Notifier","method":"rename","data":[1,"a"],"type":"rpc","tid":1},{"action":"Notifier","method":"rename","data":[2,"b"],"type":"rpc","tid":2}]`))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			provider.ServeHTTP(w, r)
+			return w.Body.String()
+		}
+		events := func(body string) []string {
+			var values []map[string]interface{}
+			So(json.Unmarshal([]byte(body), &values), ShouldBeNil)
+			So(values, ShouldHaveLength, 4)
+			So(values[0]["tid"], ShouldEqual, 1)
+			So(values[1]["tid"], ShouldEqual, 2)
+			var names []string
+			for _, value := range values[2:] {
+				So(value["type"], ShouldEqual, "event")
+				So(value["name"], ShouldEqual, "recordChanged")
+				names = append(names, value["data"].(map[string]interface{})["name"].(string))
+			}
+			return names
+		}
+
+		Convey("are appended to response array", func() {
+			So(events(post()), ShouldContain, "a")
+			So(events(post()), ShouldContain, "b")
+		})
+
+		Convey("are appended to streamed response array", func() {
+			provider.Stream(true)
+			So(events(post()), ShouldContain, "a")
+		})
+
+		Convey("are appended to response array by ActionsHandler", func() {
+			for _, handler := range []func(w http.ResponseWriter, r *http.Request){
+				ActionsHandler(provider),
+				func(w http.ResponseWriter, r *http.Request) {
+					ActionsHandlerCtx(provider)(nil, w, r)
+				},
+			} {
+				r, _ := http.NewRequest("POST", "/directapi", strings.NewReader(`[{"action":"Notifier","method":"rename","data":[1,"a"],"type":"rpc","tid":1},{"action":"Notifier","method":"rename","data":[2,"b"],"type":"rpc","tid":2}]`))
+				r.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				handler(w, r)
+				So(events(w.Body.String()), ShouldContain, "b")
+			}
+		})
+
+		Convey("are not delivered outside of transaction", func() {
+			So(Emit(nil, "recordChanged", nil), ShouldBeFalse)
+			So(Emit(context.Background(), "recordChanged", nil), ShouldBeFalse)
+		})
+	})
+
+	Convey("Call metadata", t, func() {
+		provider := NewProvider()
+		provider.RegisterAction(reflect.TypeOf(Catalog{}))
+		call := func(data string) string {
+			resps := provider.processRequests(context.Background(), nil, provider.mustDecodeTransaction(strings.NewReader(data)))
+			So(resps[0].Message, ShouldBeNil)
+			return resps[0].Result.(string)
+		}
+
+		Convey("is advertised from tags", func() {
+			apiJSON, err := provider.JSON()
+			So(err, ShouldBeNil)
+			So(apiJSON, ShouldContainSubstring, `"Catalog":[{"name":"find","len":1,"metadata":{"len":1}},{"name":"load","len":1,"metadata":{"params":["locale"]}}]`)
+			So(provider.TypeScript(), ShouldContainSubstring, "function load(arg0: number, callback?: (result: string, event: any) => void, scope?: any): void;")
+		})
+
+		Convey("is passed as typed parameter", func() {
+			So(call(`{"action":"Catalog","method":"load","data":[5],"metadata":{"locale":"de"},"type":"rpc","tid":1}`), ShouldEqual, "5:de")
+			So(call(`{"action":"Catalog","method":"load","data":[5],"type":"rpc","tid":1}`), ShouldEqual, "5")
+		})
+
+		Convey("is passed through context", func() {
+			So(call(`{"action":"Catalog","method":"find","data":["a"],"metadata":["x"],"type":"rpc","tid":1}`), ShouldEqual, "a:x")
+			So(call(`{"action":"Catalog","method":"find","data":["a"],"type":"rpc","tid":1}`), ShouldEqual, "a")
+		})
+
+		Convey("is decoded from form post", func() {
+			reqs := mustDecodeFormPost(url.Values{"extTID": {"1"}, "extAction": {"Catalog"}, "extMethod": {"find"}, "extType": {"rpc"}, "extMetadata": {`["y"]`}})
+			So(string(reqs[0].Metadata), ShouldEqual, `["y"]`)
+			So(reqs[0].FormData, ShouldBeEmpty)
+		})
+	})
+
+	Convey("CSRF protection", t, func() {
+		provider := NewProvider()
+		provider.RegisterAction(reflect.TypeOf(Db{}))
+		csrf := NewCSRF([]byte("secret"))
+		csrf.TrustedOrigins = []string{"https://app.example.com"}
+		provider.SetCSRF(csrf)
+
+		w := httptest.NewRecorder()
+		provider.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/directapi", nil))
+		cookies := w.Result().Cookies()
+		So(cookies, ShouldHaveLength, 1)
+		So(cookies[0].Name, ShouldEqual, "extdirect_session")
+		So(cookies[0].HttpOnly, ShouldBeTrue)
+		token := csrf.token(cookies[0].Value)
+		post := func(body, contentType string, header http.Header) string {
+			r := httptest.NewRequest("POST", "http://example.com/directapi", strings.NewReader(body))
+			r.Header.Set("Content-Type", contentType)
+			r.Header.Set("Origin", "http://example.com")
+			r.AddCookie(cookies[0])
+			for key, values := range header {
+				r.Header[key] = values
+			}
+			w := httptest.NewRecorder()
+			provider.ServeHTTP(w, r)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			return w.Body.String()
+		}
+		transaction := `[{"action":"Db","method":"testEcho1","data":["a"],"type":"rpc","tid":1},{"action":"Db","method":"testEcho1","data":["b"],"type":"rpc","tid":2}]`
+
+		Convey("embeds token into API script", func() {
+			So(w.Header().Get("Cache-Control"), ShouldEqual, "no-store")
+			So(w.Body.String(), ShouldEndWith, fmt.Sprintf(`;DirectApi.CSRF_TOKEN="%[1]s";DirectApi.REMOTE_API.headers=Ext.apply(DirectApi.REMOTE_API.headers||{},{"X-CSRF-Token":"%[1]s"})`, token))
+		})
+
+		Convey("accepts transaction with token in header", func() {
+			So(post(transaction, "application/json", http.Header{"X-Csrf-Token": {token}, "Origin": {"http://example.com"}}), ShouldEqual, `[{"type":"rpc","tid":1,"action":"Db","method":"testEcho1","result":"a"},{"type":"rpc","tid":2,"action":"Db","method":"testEcho1","result":"b"}]` + "\n")
+		})
+
+		Convey("rejects transaction without valid token with exceptions", func() {
+			So(post(transaction, "application/json", nil), ShouldEqual, `[{"type":"exception","tid":1,"action":"Db","method":"testEcho1","message":"CSRF check failed: missing token"},{"type":"exception","tid":2,"action":"Db","method":"testEcho1","message":"CSRF check failed: missing token"}]` + "\n")
+			So(post(transaction, "application/json", http.Header{"X-Csrf-Token": {"forged"}}), ShouldContainSubstring, `"message":"CSRF check failed: invalid token"`)
+		})
+
+		Convey("checks token of form post in field", func() {
+			form := url.Values{"extTID": {"3"}, "extAction": {"Db"}, "extMethod": {"updateBasicInfo"}, "extType": {"rpc"}, "extUpload": {"false"}, "email": {"a@b.c"}}
+			So(post(form.Encode(), "application/x-www-form-urlencoded", nil), ShouldContainSubstring, `"type":"exception"`)
+			form.Set("extCSRFToken", token)
+			So(post(form.Encode(), "application/x-www-form-urlencoded", nil), ShouldContainSubstring, `"type":"rpc"`)
+		})
+
+		Convey("verifies origin and referer", func() {
+			So(post(transaction, "application/json", http.Header{"X-Csrf-Token": {token}, "Origin": {"https://evil.example.com"}}), ShouldContainSubstring, `"message":"CSRF check failed: untrusted origin https://evil.example.com"`)
+			So(post(transaction, "application/json", http.Header{"X-Csrf-Token": {token}, "Origin": {""}, "Referer": {"https://evil.example.com/page"}}), ShouldContainSubstring, `"message":"CSRF check failed: untrusted origin https://evil.example.com"`)
+			So(post(transaction, "application/json", http.Header{"X-Csrf-Token": {token}, "Origin": {""}, "Referer": {"http://example.com/page"}}), ShouldContainSubstring, `"result":"a"`)
+			So(post(transaction, "application/json", http.Header{"X-Csrf-Token": {token}, "Origin": {""}}), ShouldContainSubstring, `"message":"CSRF check failed: missing origin"`)
+			So(post(transaction, "application/json", http.Header{"X-Csrf-Token": {token}, "Origin": {"https://app.example.com"}}), ShouldContainSubstring, `"result":"a"`)
+		})
+
+		Convey("does not embed token into API script of foreign page", func() {
+			script := func(header http.Header) string {
+				r := httptest.NewRequest("GET", "http://example.com/directapi", nil)
+				r.Header = header
+				r.AddCookie(cookies[0])
+				w := httptest.NewRecorder()
+				provider.ServeHTTP(w, r)
+				return w.Body.String()
+			}
+			So(script(http.Header{"Referer": {"https://evil.example.com/page"}}), ShouldNotContainSubstring, token)
+			So(script(http.Header{"Sec-Fetch-Site": {"cross-site"}}), ShouldNotContainSubstring, token)
+			So(script(http.Header{"Sec-Fetch-Site": {"same-site"}}), ShouldNotContainSubstring, token)
+			So(script(http.Header{"Referer": {"https://app.example.com/page"}, "Sec-Fetch-Site": {"cross-site"}}), ShouldContainSubstring, token)
+			So(script(http.Header{"Referer": {"http://example.com/page"}, "Sec-Fetch-Site": {"same-origin"}}), ShouldContainSubstring, token)
+		})
+
+		Convey("appends token to URL of WebSocket API", func() {
+			provider.SetWebSocketURL("/directapi/ws")
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "http://example.com/directapi", nil)
+			r.AddCookie(cookies[0])
+			provider.ServeHTTP(w, r)
+			So(w.Body.String(), ShouldEndWith, `;DirectApi.WEBSOCKET_API.wsUrl+="?extCSRFToken=` + token + `"`)
+		})
+
+		Convey("verifies origin and token of WebSocket handshake", func() {
+			provider.SetWebSocketURL("/directapi/ws")
+			mux := http.NewServeMux()
+			provider.Mount(mux)
+			server := httptest.NewServer(mux)
+			defer server.Close()
+			dial := func(query, origin string) error {
+				config, err := websocket.NewConfig("ws" + strings.TrimPrefix(server.URL, "http") + "/directapi/ws" + query, origin)
+				So(err, ShouldBeNil)
+				config.Header.Set("Cookie", cookies[0].String())
+				ws, err := websocket.DialConfig(config)
+				if err == nil {
+					ws.Close()
+				}
+				return err
+			}
+			So(dial("", "https://evil.example.com"), ShouldNotBeNil)
+			So(dial("", server.URL), ShouldNotBeNil)
+			So(dial("?extCSRFToken=forged", server.URL), ShouldNotBeNil)
+			So(dial("?extCSRFToken=" + token, server.URL), ShouldBeNil)
+			So(dial("?extCSRFToken=" + token, "https://app.example.com"), ShouldBeNil)
+			csrf.VerifyOrigin = false
+			So(dial("?extCSRFToken=" + token, "https://evil.example.com"), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Rate limiting", t, func() {
+		provider := NewProvider()
+		provider.RegisterAction(reflect.TypeOf(Reports{}))
+		now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		limiter := NewTokenBucketLimiter()
+		limiter.now = func() time.Time {
+			return now
+		}
+		provider.SetRateLimiter(limiter)
+		export := func(remoteAddr string) string {
+			r := httptest.NewRequest("POST", "/directapi", strings.NewReader(`{"action":"Reports","method":"export","data":null,"type":"rpc","tid":1}`))
+			r.RemoteAddr = remoteAddr
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			provider.ServeHTTP(w, r)
+			return w.Body.String()
+		}
+		exported := `[{"type":"rpc","tid":1,"action":"Reports","method":"export","result":"exported"}]` + "\n"
+
+		Convey("parses limits", func() {
+			limit, err := parseRateLimit("10/m")
+			So(err, ShouldBeNil)
+			So(*limit, ShouldResemble, rateLimit{10, time.Minute})
+			limit, err = parseRateLimit("5/30s")
+			So(err, ShouldBeNil)
+			So(*limit, ShouldResemble, rateLimit{5, 30 * time.Second})
+			_, err = parseRateLimit("10")
+			So(err, ShouldNotBeNil)
+			limit, err = parseRateLimit("1000/d")
+			So(err, ShouldBeNil)
+			So(*limit, ShouldResemble, rateLimit{1000, 24 * time.Hour})
+			limit, err = parseRateLimit("3/2d")
+			So(err, ShouldBeNil)
+			So(*limit, ShouldResemble, rateLimit{3, 48 * time.Hour})
+			_, err = parseRateLimit("x/m")
+			So(err, ShouldNotBeNil)
+			_, err = parseRateLimit("10/w")
+			So(err, ShouldNotBeNil)
+			_, err = parseRateLimit("10/xd")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("panics on registration of invalid limit", func() {
+			var recovered interface{}
+			func() {
+				defer func() { recovered = recover() }()
+				NewProvider().RegisterAction(reflect.TypeOf(InvalidLimitReports{}))
+			}()
+			So(fmt.Sprint(recovered), ShouldEqual, `InvalidLimitReports.Export: invalid rate limit period "10/w"`)
+		})
+
+		Convey("limits calls per client IP with retry-after", func() {
+			So(export("10.0.0.1:1000"), ShouldEqual, exported)
+			So(export("10.0.0.1:1001"), ShouldEqual, exported)
+			So(export("10.0.0.1:1002"), ShouldEqual, `[{"type":"exception","tid":1,"action":"Reports","method":"export","message":"rate limit of Reports.export exceeded, retry after 30s","retryAfter":30}]` + "\n")
+			So(export("10.0.0.2:1000"), ShouldEqual, exported)
+			now = now.Add(30 * time.Second)
+			So(export("10.0.0.1:1003"), ShouldEqual, exported)
+			So(export("10.0.0.1:1004"), ShouldContainSubstring, `"type":"exception"`)
+		})
+
+		Convey("identifies clients by pluggable function", func() {
+			provider.SetClientIDFunc(func(c context.Context, r *http.Request) string {
+				return "everyone"
+			})
+			So(export("10.0.0.1:1000"), ShouldEqual, exported)
+			So(export("10.0.0.2:1000"), ShouldEqual, exported)
+			So(export("10.0.0.3:1000"), ShouldContainSubstring, `"retryAfter":30`)
+		})
+
+		Convey("does not limit calls of clients without id", func() {
+			for i := 0; i < 3; i++ {
+				result, err := provider.Call(nil, "Reports", "export")
+				So(err, ShouldBeNil)
+				So(result, ShouldEqual, "exported")
+			}
+			So(limiter.buckets, ShouldBeEmpty)
+		})
+
+		Convey("removes full buckets", func() {
+			export("10.0.0.1:1000")
+			now = now.Add(2 * time.Minute)
+			export("10.0.0.2:1000")
+			So(limiter.buckets, ShouldHaveLength, 1)
+		})
+	})
+
+	Convey("Response caching", t, func() {
+		provider := NewProvider()
+		provider.RegisterAction(reflect.TypeOf(Lookups{}))
+		provider.SetUserFunc(func(c context.Context, r *http.Request) string {
+			return c.Value("user").(string)
+		})
+		atomic.StoreInt32(&lookupCalls, 0)
+		call := func(user, method string, args string) interface{} {
+			c := context.WithValue(context.Background(), "user", user)
+			resps := provider.processRequests(c, nil, provider.mustDecodeTransaction(strings.NewReader(`{"action":"Lookups","method":"` + method + `","data":` + args + `,"type":"rpc","tid":1}`)))
+			So(resps[0].Message, ShouldBeNil)
+			return resps[0].Result
+		}
+
+		Convey("caches results by arguments", func() {
+			So(call("bob", "countries", `["eu"]`), ShouldResemble, []string{"eu1"})
+			So(call("alice", "countries", `[ "eu" ]`), ShouldResemble, []string{"eu1"})
+			So(call("bob", "countries", `["us"]`), ShouldResemble, []string{"us2"})
+		})
+
+		Convey("caches results by user", func() {
+			So(call("bob", "greeting", `null`), ShouldEqual, "hello bob #1")
+			So(call("bob", "greeting", `null`), ShouldEqual, "hello bob #1")
+			So(call("alice", "greeting", `null`), ShouldEqual, "hello alice #2")
+		})
+
+		Convey("invalidates results from other methods", func() {
+			call("bob", "countries", `["eu"]`)
+			call("bob", "countries", `["us"]`)
+			call("bob", "addCountry", `["eu"]`)
+			So(call("bob", "countries", `["eu"]`), ShouldResemble, []string{"eu3"})
+			So(call("bob", "countries", `["us"]`), ShouldResemble, []string{"us2"})
+			call("bob", "reset", `null`)
+			So(call("bob", "countries", `["us"]`), ShouldResemble, []string{"us4"})
+		})
+
+		Convey("in-memory LRU cache expires and evicts values", func() {
+			now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			cache := NewLRUCache(2)
+			cache.now = func() time.Time {
+				return now
+			}
+			cache.Set("a", 1, time.Minute)
+			cache.Set("b", 2, time.Hour)
+			_, ok := cache.Get("a")
+			So(ok, ShouldBeTrue)
+			cache.Set("c", 3, time.Hour)
+			_, ok = cache.Get("b")
+			So(ok, ShouldBeFalse)
+			So(cache.Len(), ShouldEqual, 2)
+			now = now.Add(2 * time.Minute)
+			_, ok = cache.Get("a")
+			So(ok, ShouldBeFalse)
+			value, ok := cache.Get("c")
+			So(ok, ShouldBeTrue)
+			So(value, ShouldEqual, 3)
+		})
+	})
+
+	Convey("Idempotency keys", t, func() {
+		provider := NewProvider()
+		provider.RegisterAction(reflect.TypeOf(Orders{}))
+		provider.SetIdempotency(NewLRUCache(100), time.Hour)
+		atomic.StoreInt32(&orderCalls, 0)
+		post := func(key string, body string) string {
+			r := httptest.NewRequest("POST", "/directapi", strings.NewReader(body))
+			r.Header.Set("Content-Type", "application/json")
+			if key != "" {
+				r.Header.Set("Idempotency-Key", key)
+			}
+			w := httptest.NewRecorder()
+			provider.ServeHTTP(w, r)
+			return w.Body.String()
+		}
+		call := func(data string) *response {
+			return provider.processRequests(context.Background(), nil, provider.mustDecodeTransaction(strings.NewReader(data)))[0]
+		}
+		transaction := `[{"action":"Orders","method":"update","data":[1],"type":"rpc","tid":1},{"action":"Orders","method":"update","data":[2],"type":"rpc","tid":2}]`
+
+		Convey("replays transaction with the same header key", func() {
+			first := post("k1", transaction)
+			So(first, ShouldContainSubstring, `"result":"updated 1 #`)
+			So(post("k1", transaction), ShouldEqual, first)
+			So(atomic.LoadInt32(&orderCalls), ShouldEqual, 2)
+			So(post("k2", transaction), ShouldNotEqual, first)
+			So(post("", transaction), ShouldNotEqual, first)
+			So(atomic.LoadInt32(&orderCalls), ShouldEqual, 6)
+		})
+
+		Convey("replays call with the same metadata key", func() {
+			So(call(`{"action":"Orders","method":"update","data":[1],"metadata":{"idempotencyKey":"m1"},"type":"rpc","tid":1}`).Result, ShouldEqual, "updated 1 #1")
+			So(call(`{"action":"Orders","method":"update","data":[1],"metadata":{"idempotencyKey":"m1"},"type":"rpc","tid":7}`).Result, ShouldEqual, "updated 1 #1")
+			So(call(`{"action":"Orders","method":"update","data":[1],"metadata":{"idempotencyKey":"m2"},"type":"rpc","tid":1}`).Result, ShouldEqual, "updated 1 #2")
+		})
+
+		Convey("executes failed call again", func() {
+			So(*call(`{"action":"Orders","method":"charge","data":null,"metadata":{"idempotencyKey":"c"},"type":"rpc","tid":1}`).Message, ShouldEqual, "declined")
+			So(call(`{"action":"Orders","method":"charge","data":null,"metadata":{"idempotencyKey":"c"},"type":"rpc","tid":1}`).Result, ShouldEqual, "charged #2")
+			So(call(`{"action":"Orders","method":"charge","data":null,"metadata":{"idempotencyKey":"c"},"type":"rpc","tid":1}`).Result, ShouldEqual, "charged #2")
+		})
+
+		Convey("waits for duplicate in progress", func() {
+			store := notifyingCache{NewLRUCache(100), make(chan string, 10)}
+			provider.SetIdempotency(store, time.Hour)
+			ordersGate = make(chan struct{})
+			results := make(chan interface{}, 2)
+			for i := 0; i < 2; i++ {
+				go func() {
+					results <- call(`{"action":"Orders","method":"slow","data":null,"metadata":{"idempotencyKey":"s"},"type":"rpc","tid":1}`).Result
+				}()
+			}
+			// Gate opens once both calls looked up stored result, so the later one waits for the call holding key.
+			receiveWithin(store.gets)
+			receiveWithin(store.gets)
+			close(ordersGate)
+			So(receiveWithin(results), ShouldEqual, 1)
+			So(receiveWithin(results), ShouldEqual, 1)
+			So(atomic.LoadInt32(&orderCalls), ShouldEqual, 1)
+		})
+	})
+
+	Convey("Coalescing of identical calls", t, func() {
+		provider := NewProvider()
+		provider.RegisterAction(reflect.TypeOf(Dashboard{}))
+		provider.SetUserFunc(func(c context.Context, r *http.Request) string {
+			return r.URL.Query().Get("user")
+		})
+		logger := waitingLogger{make(chan string, 4)}
+		provider.SetLogger(logger)
+		provider.Debug(true)
+		atomic.StoreInt32(&dashboardCalls, 0)
+		dashboardGate = make(chan struct{})
+		dashboardEntered = make(chan string, 4)
+		resps := make(chan *response, 4)
+		load := func(user, method, panel string) {
+			go func() {
+				r := httptest.NewRequest("POST", "/directapi?user=" + user, nil)
+				reqs := provider.mustDecodeTransaction(strings.NewReader(`{"action":"Dashboard","method":"` + method + `","data":["` + panel + `"],"type":"rpc","tid":1}`))
+				resps <- provider.processRequests(context.Background(), r, reqs)[0]
+			}()
+		}
+		result := func() interface{} {
+			return receiveWithin(resps).Result
+		}
+
+		Convey("executes method once for identical calls of user", func() {
+			for _, panel := range []string{"sales", "sales", "sales", "stock"} {
+				load("alice", "getRecords", panel)
+			}
+			// Gate opens once duplicate sales calls wait for the loading one.
+			receiveWithin(logger.waiting)
+			receiveWithin(logger.waiting)
+			close(dashboardGate)
+			counts := make(map[string]int)
+			for i := 0; i < 4; i++ {
+				result := result().(string)
+				counts[result[:strings.Index(result, " ")]]++
+				counts[result]++
+			}
+			So(atomic.LoadInt32(&dashboardCalls), ShouldEqual, 2)
+			So(counts, ShouldHaveLength, 4)
+			So(counts["sales"], ShouldEqual, 3)
+			So(counts["stock"], ShouldEqual, 1)
+			So(provider.coalescer.calls, ShouldBeEmpty)
+		})
+
+		Convey("never merges calls of different users", func() {
+			load("alice", "getRecords", "sales")
+			load("bob", "getRecords", "sales")
+			// Gate opens once both calls execute method.
+			receiveWithin(dashboardEntered)
+			receiveWithin(dashboardEntered)
+			close(dashboardGate)
+			So(result(), ShouldNotEqual, result())
+			So(atomic.LoadInt32(&dashboardCalls), ShouldEqual, 2)
+		})
+
+		Convey("never merges calls without user", func() {
+			load("", "getRecords", "sales")
+			load("", "getRecords", "sales")
+			receiveWithin(dashboardEntered)
+			receiveWithin(dashboardEntered)
+			close(dashboardGate)
+			So(result(), ShouldNotEqual, result())
+			So(atomic.LoadInt32(&dashboardCalls), ShouldEqual, 2)
+		})
+
+		Convey("limits identical calls per client before joining them", func() {
+			load("alice", "getTotals", "sales")
+			receiveWithin(dashboardEntered)
+			load("alice", "getTotals", "sales")
+			limited := receiveWithin(resps)
+			So(limited.Type, ShouldEqual, "exception")
+			So(*limited.Message, ShouldStartWith, "rate limit of Dashboard.getTotals exceeded")
+			close(dashboardGate)
+			So(result(), ShouldEqual, "sales #1")
+		})
+	})
+
+	Convey("Transactional batches", t, func() {
+		provider := NewProvider()
+		provider.RegisterAction(reflect.TypeOf(Invoices{}))
+		var uow *recordingUnitOfWork
+		var beginErr error
+		provider.SetUnitOfWork(func(c context.Context, r *http.Request) (UnitOfWork, error) {
+			if beginErr != nil {
+				return nil, beginErr
+			}
+			uow = &recordingUnitOfWork{}
+			return uow, nil
+		})
+		batch := func(lines ...int) []*response {
+			data := `[{"action":"Invoices","method":"saveHeader","data":[1],"type":"rpc","tid":1}`
+			for i, line := range lines {
+				data += fmt.Sprintf(`,{"action":"Invoices","method":"saveLine","data":[%d],"type":"rpc","tid":%d}`, line, i + 2)
+			}
+			return provider.processRequests(nil, nil, provider.mustDecodeTransaction(strings.NewReader(data + "]")))
+		}
+
+		Convey("executes calls sequentially sharing unit of work and commits it", func() {
+			resps := batch(1, 2, 3)
+			So(uow.ops, ShouldResemble, []string{"header 1", "line 1", "line 2", "line 3", "commit"})
+			for i, resp := range resps {
+				So(resp.Type, ShouldEqual, "rpc")
+				So(resp.Tid, ShouldEqual, i + 1)
+			}
+			So(resps[3].Result, ShouldEqual, 3)
+		})
+
+		Convey("rolls back after exception and marks other calls as exceptions", func() {
+			resps := batch(1, -1, 3)
+			So(uow.ops, ShouldResemble, []string{"header 1", "line 1", "rollback"})
+			So(uow.rollback, ShouldResemble, ErrException{"Invoices", "saveLine", "invalid line"})
+			So(*resps[2].Message, ShouldEqual, "invalid line")
+			for _, i := range []int{0, 1, 3} {
+				So(resps[i].Type, ShouldEqual, "exception")
+				So(resps[i].Tid, ShouldEqual, i + 1)
+				So(*resps[i].Message, ShouldEqual, "batch rolled back after exception in Invoices.saveLine()")
+			}
+		})
+
+		Convey("does not cache results or deliver events of rolled back batch", func() {
+			post := func(data string) string {
+				r := httptest.NewRequest("POST", "/directapi", strings.NewReader(data))
+				r.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				provider.ServeHTTP(w, r)
+				return w.Body.String()
+			}
+			body := post(`[{"action":"Invoices","method":"saveLine","data":[1],"type":"rpc","tid":1},{"action":"Invoices","method":"total","data":[],"type":"rpc","tid":2},{"action":"Invoices","method":"saveLine","data":[-1],"type":"rpc","tid":3}]`)
+			So(body, ShouldContainSubstring, `"message":"invalid line"`)
+			So(body, ShouldNotContainSubstring, `"lineSaved"`)
+			So(provider.cache.(*LRUCache).Len(), ShouldEqual, 0)
+			body = post(`[{"action":"Invoices","method":"saveLine","data":[1],"type":"rpc","tid":1},{"action":"Invoices","method":"total","data":[],"type":"rpc","tid":2}]`)
+			So(body, ShouldContainSubstring, `{"type":"rpc","tid":2,"action":"Invoices","method":"total","result":2}`)
+			So(body, ShouldContainSubstring, `{"type":"event","name":"lineSaved","data":1}`)
+			So(provider.cache.(*LRUCache).Len(), ShouldEqual, 0)
+		})
+
+		Convey("fails all calls if unit of work cannot begin or commit", func() {
+			beginErr = errors.New("no connection")
+			for _, resp := range batch(1) {
+				So(*resp.Message, ShouldEqual, "could not begin unit of work: no connection")
+			}
+			beginErr = nil
+			provider.SetUnitOfWork(func(c context.Context, r *http.Request) (UnitOfWork, error) {
+				return &recordingUnitOfWork{commitErr: errors.New("conflict")}, nil
+			})
+			for _, resp := range batch(1) {
+				So(*resp.Message, ShouldEqual, "could not commit unit of work: conflict")
+			}
+		})
+
+		Convey("is not used if disabled", func() {
+			provider.SetUnitOfWork(nil)
+			So(CurrentUnitOfWork(context.Background()), ShouldBeNil)
+			So(batch()[0].Result, ShouldEqual, 1)
+		})
+	})
 }
\ No newline at end of file
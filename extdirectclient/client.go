@@ -0,0 +1,388 @@
+// Package extdirectclient provides client calling direct methods of remote Ext Direct endpoints.
+package extdirectclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"github.com/nbgo/extdirect"
+)
+
+// Method is a direct method declared by remote API.
+type Method struct {
+	Name        string
+	// Len is a number of arguments of method; nil for form handler.
+	Len         *int
+	FormHandler bool
+}
+
+// UnmarshalJSON implements json.Unmarshaler accepting both formHandler and formHander (as sent by extdirect) keys.
+func (method *Method) UnmarshalJSON(data []byte) error {
+	var m struct {
+		Name        string `json:"name"`
+		Len         *int   `json:"len"`
+		FormHandler *bool  `json:"formHandler"`
+		FormHander  *bool  `json:"formHander"`
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	method.Name = m.Name
+	method.Len = m.Len
+	method.FormHandler = (m.FormHandler != nil && *m.FormHandler) || (m.FormHander != nil && *m.FormHander)
+	return nil
+}
+
+// API is a remote API descriptor (REMOTE_API of provider).
+type API struct {
+	ID        string              `json:"id"`
+	Type      string              `json:"type"`
+	URL       string              `json:"url"`
+	Namespace string              `json:"namespace"`
+	Timeout   int                 `json:"timeout"`
+	Actions   map[string][]Method `json:"actions"`
+}
+
+// ErrInvalidAPI occurs when fetched API is neither JSON descriptor nor script declaring REMOTE_API.
+type ErrInvalidAPI string
+
+func (err ErrInvalidAPI) Error() string {
+	return fmt.Sprintf("invalid Ext Direct API at %s", string(err))
+}
+
+// ErrArgsLen occurs when number of call arguments differs from len declared by remote API.
+type ErrArgsLen struct {
+	Action string
+	Method string
+	Len    int
+	Got    int
+}
+
+func (err ErrArgsLen) Error() string {
+	return fmt.Sprintf("direct method %v.%v expects %v arguments, got %v", err.Action, err.Method, err.Len, err.Got)
+}
+
+// ErrMissingResponse occurs when transaction response has no response for call.
+type ErrMissingResponse struct {
+	Action string
+	Method string
+	Tid    int
+}
+
+func (err ErrMissingResponse) Error() string {
+	return fmt.Sprintf("no response for %v.%v (tid %v)", err.Action, err.Method, err.Tid)
+}
+
+// Client calls direct methods of remote API.
+type Client struct {
+	API        *API
+	// URL is an absolute URL of router transactions are posted to.
+	URL        string
+	// HTTPClient is used to send requests; http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// Header is added to every request.
+	Header     http.Header
+	// OnEvent is called for every event appended to transaction response if it is not nil.
+	OnEvent    func(name string, data json.RawMessage)
+	tid        int64
+}
+
+// Call is a direct method call of batch.
+type Call struct {
+	Action string
+	Method string
+	Args   []interface{}
+	// Result is a pointer to value where result is decoded if not nil.
+	Result interface{}
+	// Err is set to extdirect.ErrException if call resulted in exception.
+	Err    error
+	tid    int
+}
+
+// NewClient fetches API descriptor from apiURL and creates client for it.
+// apiURL may return either JSON descriptor or API script of provider.
+func NewClient(c context.Context, apiURL string, httpClient *http.Client) (*Client, error) {
+	client := &Client{HTTPClient: httpClient}
+	r, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.do(c, r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v of %s", resp.StatusCode, apiURL)
+	}
+	api, err := ParseAPI(body)
+	if err != nil {
+		return nil, ErrInvalidAPI(apiURL)
+	}
+	routerURL, err := resolveURL(apiURL, api.URL)
+	if err != nil {
+		return nil, err
+	}
+	client.API = api
+	client.URL = routerURL
+	return client, nil
+}
+
+// ParseAPI parses JSON descriptor or API script declaring <Namespace>.REMOTE_API.
+func ParseAPI(data []byte) (*API, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		i := bytes.Index(data, []byte(".REMOTE_API="))
+		if i < 0 {
+			return nil, ErrInvalidAPI("script")
+		}
+		data = data[i + len(".REMOTE_API="):]
+	}
+	// Decoder stops after descriptor object, so rest of script is ignored.
+	api := &API{}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(api); err != nil {
+		return nil, err
+	}
+	return api, nil
+}
+
+func resolveURL(base, ref string) (string, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return baseURL.ResolveReference(refURL).String(), nil
+}
+
+// Actions returns sorted names of actions of remote API.
+func (client *Client) Actions() []string {
+	actions := make([]string, 0, len(client.API.Actions))
+	for action := range client.API.Actions {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+// Methods returns methods of action of remote API or nil if there is no such action.
+func (client *Client) Methods(action string) []Method {
+	return client.API.Actions[action]
+}
+
+// Method returns method of remote API or extdirect.ErrUnknownMethod if there is no such method.
+func (client *Client) Method(action, method string) (Method, error) {
+	methods, ok := client.API.Actions[action]
+	if !ok {
+		return Method{}, extdirect.ErrUnknownMethod{Action: action}
+	}
+	for _, m := range methods {
+		if m.Name == method {
+			return m, nil
+		}
+	}
+	return Method{}, extdirect.ErrUnknownMethod{Action: action, Method: method}
+}
+
+// Call calls direct method and decodes its result into value pointed by result if it is not nil.
+// Exception is returned as extdirect.ErrException.
+func (client *Client) Call(c context.Context, action, method string, result interface{}, args ...interface{}) error {
+	call := &Call{Action: action, Method: method, Args: args, Result: result}
+	if err := client.Batch(c, call); err != nil {
+		return err
+	}
+	return call.Err
+}
+
+type transactionRequest struct {
+	Action string        `json:"action"`
+	Method string        `json:"method"`
+	Data   []interface{} `json:"data"`
+	Type   string        `json:"type"`
+	Tid    int           `json:"tid"`
+}
+
+type transactionResponse struct {
+	Type    string          `json:"type"`
+	Tid     int             `json:"tid"`
+	Action  string          `json:"action"`
+	Method  string          `json:"method"`
+	Message string          `json:"message"`
+	Result  json.RawMessage `json:"result"`
+	Name    string          `json:"name"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Batch posts calls in single transaction and sets their results and exceptions matched by tid.
+// Responses are accepted as array or, for single call, as single object.
+// Returned error is an error of validation, transport or decoding, not an exception of any call.
+func (client *Client) Batch(c context.Context, calls ...*Call) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	reqs := make([]transactionRequest, len(calls))
+	callsByTid := make(map[int]*Call, len(calls))
+	for i, call := range calls {
+		method, err := client.Method(call.Action, call.Method)
+		if err != nil {
+			return err
+		}
+		if method.Len != nil && *method.Len != len(call.Args) {
+			return ErrArgsLen{call.Action, call.Method, *method.Len, len(call.Args)}
+		}
+		call.tid = client.nextTid()
+		call.Err = nil
+		callsByTid[call.tid] = call
+		reqs[i] = transactionRequest{call.Action, call.Method, call.Args, "rpc", call.tid}
+	}
+	body, err := json.Marshal(reqs)
+	if err != nil {
+		return err
+	}
+
+	r, err := http.NewRequest("POST", client.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	var data json.RawMessage
+	if err := client.post(c, r, &data); err != nil {
+		return err
+	}
+	resps, err := decodeTransactionResponses(data)
+	if err != nil {
+		return err
+	}
+
+	answered := make(map[int]bool, len(resps))
+	for _, resp := range resps {
+		if resp.Type == "event" {
+			if client.OnEvent != nil {
+				client.OnEvent(resp.Name, resp.Data)
+			}
+			continue
+		}
+		call, ok := callsByTid[resp.Tid]
+		if !ok {
+			return fmt.Errorf("unexpected response tid %v", resp.Tid)
+		}
+		answered[resp.Tid] = true
+		if err := decodeResponse(call, resp); err != nil {
+			return err
+		}
+	}
+	for _, call := range calls {
+		if !answered[call.tid] {
+			return ErrMissingResponse{call.Action, call.Method, call.tid}
+		}
+	}
+	return nil
+}
+
+// Submit posts form to form handler method and decodes its result into value pointed by result if it is not nil.
+// Exception is returned as extdirect.ErrException.
+func (client *Client) Submit(c context.Context, action, method string, form url.Values, result interface{}) error {
+	if _, err := client.Method(action, method); err != nil {
+		return err
+	}
+	call := &Call{Action: action, Method: method, Result: result, tid: client.nextTid()}
+	values := url.Values{}
+	for key, value := range form {
+		values[key] = value
+	}
+	values.Set("extAction", action)
+	values.Set("extMethod", method)
+	values.Set("extType", "rpc")
+	values.Set("extTID", strconv.Itoa(call.tid))
+	values.Set("extUpload", "false")
+
+	r, err := http.NewRequest("POST", client.URL, bytes.NewBufferString(values.Encode()))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var resp transactionResponse
+	if err := client.post(c, r, &resp); err != nil {
+		return err
+	}
+	if resp.Tid != call.tid {
+		return fmt.Errorf("unexpected response tid %v", resp.Tid)
+	}
+	if err := decodeResponse(call, resp); err != nil {
+		return err
+	}
+	return call.Err
+}
+
+// decodeTransactionResponses decodes responses of transaction sent as array or, for single request, as object.
+func decodeTransactionResponses(data json.RawMessage) ([]transactionResponse, error) {
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		var resp transactionResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, err
+		}
+		return []transactionResponse{resp}, nil
+	}
+	var resps []transactionResponse
+	if err := json.Unmarshal(data, &resps); err != nil {
+		return nil, err
+	}
+	return resps, nil
+}
+
+func decodeResponse(call *Call, resp transactionResponse) error {
+	if resp.Type == "exception" {
+		call.Err = extdirect.ErrException{Action: resp.Action, Method: resp.Method, Message: resp.Message}
+		return nil
+	}
+	if call.Result != nil && len(resp.Result) > 0 {
+		return json.Unmarshal(resp.Result, call.Result)
+	}
+	return nil
+}
+
+func (client *Client) nextTid() int {
+	return int(atomic.AddInt64(&client.tid, 1))
+}
+
+func (client *Client) post(c context.Context, r *http.Request, v interface{}) error {
+	resp, err := client.do(c, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %v: %s", resp.StatusCode, body)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (client *Client) do(c context.Context, r *http.Request) (*http.Response, error) {
+	if c != nil {
+		r = r.WithContext(c)
+	}
+	for key, values := range client.Header {
+		r.Header[key] = values
+	}
+	httpClient := client.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return httpClient.Do(r)
+}
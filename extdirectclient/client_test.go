@@ -0,0 +1,167 @@
+package extdirectclient
+
+import (
+	"testing"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/nbgo/extdirect"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+)
+
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type Geometry struct {
+	C                context.Context
+	R                *http.Request
+	UpdateLabelTags  extdirect.DirectMethodTags `formhandler:"true"`
+}
+
+func (this Geometry) Move(p Point, dx int, dy int) *Point {
+	return &Point{p.X + dx, p.Y + dy}
+}
+func (this Geometry) Header() string {
+	return this.R.Header.Get("X-Test")
+}
+func (this Geometry) Touch() bool {
+	return extdirect.Emit(this.C, "touched", this.R.Header.Get("X-Test"))
+}
+func (this Geometry) Fail() error {
+	return errors.New("failed")
+}
+func (this Geometry) UpdateLabel(data map[string]string) (result *extdirect.DirectFormHandlerResult) {
+	result = &extdirect.DirectFormHandlerResult{Success: data["label"] != ""}
+	if !result.Success {
+		result.Errors = map[string]string{"label": "required"}
+	}
+	return
+}
+
+func TestClient(t *testing.T) {
+	Convey("Client", t, func() {
+		provider := extdirect.NewProvider()
+		provider.URL = "/router"
+		provider.RegisterAction(reflect.TypeOf(Geometry{}))
+		mux := http.NewServeMux()
+		mux.Handle("/api.js", provider)
+		mux.Handle("/router", provider)
+		server := httptest.NewServer(mux)
+		defer server.Close()
+		c := context.Background()
+
+		Convey("fails to fetch invalid API", func() {
+			_, err := NewClient(c, server.URL + "/missing", nil)
+			So(err, ShouldNotBeNil)
+		})
+
+		client, err := NewClient(c, server.URL + "/api.js", nil)
+		So(err, ShouldBeNil)
+		client.Header = http.Header{"X-Test": []string{"!"}}
+
+		Convey("fetches API from script", func() {
+			So(client.URL, ShouldEqual, server.URL + "/router")
+			So(client.API.Namespace, ShouldEqual, "DirectApi")
+			So(client.Actions(), ShouldResemble, []string{"Geometry"})
+			So(client.Methods("Geometry"), ShouldHaveLength, 5)
+			method, err := client.Method("Geometry", "move")
+			So(err, ShouldBeNil)
+			So(*method.Len, ShouldEqual, 3)
+			method, err = client.Method("Geometry", "updateLabel")
+			So(err, ShouldBeNil)
+			So(method.FormHandler, ShouldBeTrue)
+		})
+
+		Convey("parses JSON API", func() {
+			apiJSON, _ := provider.JSON()
+			api, err := ParseAPI([]byte(apiJSON))
+			So(err, ShouldBeNil)
+			So(api.URL, ShouldEqual, "/router")
+			So(api.Actions["Geometry"], ShouldHaveLength, 5)
+		})
+
+		Convey("calls method with typed result", func() {
+			var p Point
+			So(client.Call(c, "Geometry", "move", &p, Point{1, 2}, 10, 20), ShouldBeNil)
+			So(p, ShouldResemble, Point{11, 22})
+		})
+
+		Convey("sends header", func() {
+			var header string
+			So(client.Call(c, "Geometry", "header", &header), ShouldBeNil)
+			So(header, ShouldEqual, "!")
+		})
+
+		Convey("returns exception", func() {
+			err := client.Call(c, "Geometry", "fail", nil)
+			So(err, ShouldResemble, extdirect.ErrException{Action: "Geometry", Method: "fail", Message: "failed"})
+		})
+
+		Convey("validates calls", func() {
+			So(client.Call(c, "Geometry", "unknown", nil), ShouldResemble, extdirect.ErrUnknownMethod{Action: "Geometry", Method: "unknown"})
+			So(client.Call(c, "Unknown", "move", nil), ShouldResemble, extdirect.ErrUnknownMethod{Action: "Unknown"})
+			So(client.Call(c, "Geometry", "move", nil, Point{}), ShouldResemble, ErrArgsLen{"Geometry", "move", 3, 1})
+		})
+
+		Convey("calls batch correlated by tid", func() {
+			var p1, p2 Point
+			var header string
+			calls := []*Call{
+				{Action: "Geometry", Method: "move", Args: []interface{}{Point{0, 0}, 1, 1}, Result: &p1},
+				{Action: "Geometry", Method: "fail"},
+				{Action: "Geometry", Method: "move", Args: []interface{}{Point{5, 5}, -1, -1}, Result: &p2},
+				{Action: "Geometry", Method: "header", Result: &header},
+			}
+			So(client.Batch(c, calls...), ShouldBeNil)
+			So(p1, ShouldResemble, Point{1, 1})
+			So(p2, ShouldResemble, Point{4, 4})
+			So(header, ShouldEqual, "!")
+			So(calls[0].Err, ShouldBeNil)
+			So(calls[1].Err, ShouldResemble, extdirect.ErrException{Action: "Geometry", Method: "fail", Message: "failed"})
+			So(calls[2].Err, ShouldBeNil)
+		})
+
+		Convey("accepts single response object of single call", func() {
+			single := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var reqs []map[string]interface{}
+				json.NewDecoder(r.Body).Decode(&reqs)
+				fmt.Fprintf(w, `{"type":"rpc","tid":%v,"action":"Geometry","method":"move","result":{"x":3,"y":4}}`, reqs[0]["tid"])
+			}))
+			defer single.Close()
+			client.URL = single.URL
+			var p Point
+			So(client.Call(c, "Geometry", "move", &p, Point{}, 0, 0), ShouldBeNil)
+			So(p, ShouldResemble, Point{3, 4})
+		})
+
+		Convey("delivers events appended to response", func() {
+			var names []string
+			var data []string
+			client.OnEvent = func(name string, value json.RawMessage) {
+				names = append(names, name)
+				data = append(data, string(value))
+			}
+			var touched bool
+			So(client.Call(c, "Geometry", "touch", &touched), ShouldBeNil)
+			So(touched, ShouldBeTrue)
+			So(names, ShouldResemble, []string{"touched"})
+			So(data, ShouldResemble, []string{`"!"`})
+		})
+
+		Convey("submits form", func() {
+			var result extdirect.DirectFormHandlerResult
+			So(client.Submit(c, "Geometry", "updateLabel", url.Values{"label": {"a"}}, &result), ShouldBeNil)
+			So(result.Success, ShouldBeTrue)
+			So(client.Submit(c, "Geometry", "updateLabel", url.Values{}, &result), ShouldBeNil)
+			So(result.Success, ShouldBeFalse)
+			So(result.Errors, ShouldResemble, map[string]string{"label": "required"})
+		})
+	})
+}
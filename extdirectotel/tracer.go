@@ -0,0 +1,67 @@
+// Package extdirectotel provides OpenTelemetry implementation of extdirect.Tracer.
+package extdirectotel
+
+import (
+	"context"
+	"net/http"
+	"github.com/nbgo/extdirect"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is a name of tracer obtained from tracer provider.
+const InstrumentationName = "github.com/nbgo/extdirect"
+
+// Tracer is an OpenTelemetry implementation of extdirect.Tracer.
+type Tracer struct {
+	Tracer     trace.Tracer
+	Propagator propagation.TextMapPropagator
+}
+
+var _ extdirect.Tracer = &Tracer{}
+
+// NewTracer creates tracer with spans from tracer provider and W3C trace context propagation.
+func NewTracer(tracerProvider trace.TracerProvider) *Tracer {
+	return &Tracer{
+		Tracer: tracerProvider.Tracer(InstrumentationName),
+		Propagator: propagation.TraceContext{},
+	}
+}
+
+// StartBatch implements extdirect.Tracer.StartBatch(). Trace context of request headers becomes parent of batch span.
+func (tracer *Tracer) StartBatch(c context.Context, r *http.Request, size int) (context.Context, extdirect.Span) {
+	if r != nil {
+		c = tracer.Propagator.Extract(c, propagation.HeaderCarrier(r.Header))
+	}
+	c, span := tracer.Tracer.Start(c, "extdirect.batch",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.Int("extdirect.batch.size", size)))
+	return c, &otelSpan{span}
+}
+
+// StartCall implements extdirect.Tracer.StartCall().
+func (tracer *Tracer) StartCall(c context.Context, action, method string, tid int) (context.Context, extdirect.Span) {
+	c, span := tracer.Tracer.Start(c, action + "." + method,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			attribute.String("extdirect.action", action),
+			attribute.String("extdirect.method", method),
+			attribute.Int("extdirect.tid", tid)))
+	return c, &otelSpan{span}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s *otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	} else {
+		s.span.SetStatus(codes.Ok, "")
+	}
+	s.span.End()
+}
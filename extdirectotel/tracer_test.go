@@ -0,0 +1,87 @@
+package extdirectotel
+
+import (
+	"testing"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/nbgo/extdirect"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Db struct {
+	C context.Context
+}
+
+func (this Db) TraceID() string {
+	return trace.SpanContextFromContext(this.C).TraceID().String()
+}
+func (this Db) Fail() error {
+	return errors.New("failed")
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracer(t *testing.T) {
+	Convey("OpenTelemetry tracer", t, func() {
+		recorder := tracetest.NewSpanRecorder()
+		provider := extdirect.NewProvider()
+		provider.SetTracer(NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+		provider.RegisterAction(reflect.TypeOf(Db{}))
+
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("POST", provider.URL, strings.NewReader(`[{"action":"Db","method":"traceID","data":null,"type":"rpc","tid":1},{"action":"Db","method":"fail","data":null,"type":"rpc","tid":2}]`))
+		So(err, ShouldBeNil)
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		provider.ServeHTTP(w, r)
+
+		Convey("propagates trace context into method context", func() {
+			So(w.Body.String(), ShouldContainSubstring, `"result":"4bf92f3577b34da6a3ce929d0e0e4736"`)
+		})
+
+		Convey("records batch span with child span for every call", func() {
+			spans := recorder.Ended()
+			So(len(spans), ShouldEqual, 3)
+			spansByName := make(map[string]sdktrace.ReadOnlySpan)
+			for _, span := range spans {
+				spansByName[span.Name()] = span
+			}
+			So(spansByName, ShouldContainKey, "extdirect.batch")
+			So(spansByName, ShouldContainKey, "Db.traceID")
+			So(spansByName, ShouldContainKey, "Db.fail")
+
+			batch := spansByName["extdirect.batch"]
+			So(batch.Parent().SpanID().String(), ShouldEqual, "00f067aa0ba902b7")
+			So(batch.SpanContext().TraceID().String(), ShouldEqual, "4bf92f3577b34da6a3ce929d0e0e4736")
+			So(spanAttribute(batch, "extdirect.batch.size").AsInt64(), ShouldEqual, 2)
+
+			call := spansByName["Db.traceID"]
+			So(call.Parent().SpanID(), ShouldEqual, batch.SpanContext().SpanID())
+			So(spanAttribute(call, "extdirect.action").AsString(), ShouldEqual, "Db")
+			So(spanAttribute(call, "extdirect.method").AsString(), ShouldEqual, "traceID")
+			So(spanAttribute(call, "extdirect.tid").AsInt64(), ShouldEqual, 1)
+			So(call.Status().Code, ShouldEqual, codes.Ok)
+
+			failedCall := spansByName["Db.fail"]
+			So(failedCall.Parent().SpanID(), ShouldEqual, batch.SpanContext().SpanID())
+			So(failedCall.Status().Code, ShouldEqual, codes.Error)
+			So(failedCall.Status().Description, ShouldContainSubstring, "failed")
+		})
+	})
+}
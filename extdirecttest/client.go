@@ -0,0 +1,164 @@
+// Package extdirecttest provides client calling direct actions of provider in tests.
+package extdirecttest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"github.com/nbgo/extdirect"
+)
+
+// Client calls direct methods of provider either in process or through its HTTP handler.
+type Client struct {
+	Provider *extdirect.DirectServiceProvider
+	// HTTP enables sending of calls as JSON transactions to provider HTTP handler to exercise encoding.
+	HTTP     bool
+	// Header is added to HTTP requests.
+	Header   http.Header
+}
+
+// NewClient creates client calling methods of provider in process.
+func NewClient(provider *extdirect.DirectServiceProvider) *Client {
+	return &Client{Provider: provider}
+}
+
+// Call is a direct method call of batch.
+type Call struct {
+	Action string
+	Method string
+	Args   []interface{}
+	// Result is a pointer to value where result is decoded if not nil.
+	Result interface{}
+	// Err is set to extdirect.ErrException if call resulted in exception.
+	Err    error
+}
+
+// Call calls direct method and stores its result into value pointed by result if it is not nil.
+// Exception is returned as extdirect.ErrException.
+func (client *Client) Call(c context.Context, action, method string, result interface{}, args ...interface{}) error {
+	call := &Call{Action: action, Method: method, Args: args, Result: result}
+	if err := client.Batch(c, call); err != nil {
+		return err
+	}
+	return call.Err
+}
+
+// Batch calls direct methods in single transaction and sets their results and exceptions.
+// Returned error is an error of transport or decoding, not an exception of any call.
+func (client *Client) Batch(c context.Context, calls ...*Call) error {
+	if client.HTTP {
+		return client.batchHTTP(c, calls)
+	}
+
+	directCalls := make([]*extdirect.DirectCall, len(calls))
+	for i, call := range calls {
+		directCalls[i] = &extdirect.DirectCall{Action: call.Action, Method: call.Method, Args: call.Args}
+	}
+	if err := client.Provider.CallBatch(c, directCalls...); err != nil {
+		return err
+	}
+	for i, call := range calls {
+		call.Err = directCalls[i].Err
+		if call.Err == nil {
+			if err := assign(call.Result, directCalls[i].Result); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type transactionRequest struct {
+	Action string        `json:"action"`
+	Method string        `json:"method"`
+	Data   []interface{} `json:"data"`
+	Type   string        `json:"type"`
+	Tid    int           `json:"tid"`
+}
+
+type transactionResponse struct {
+	Type    string          `json:"type"`
+	Tid     int             `json:"tid"`
+	Action  string          `json:"action"`
+	Method  string          `json:"method"`
+	Message string          `json:"message"`
+	Result  json.RawMessage `json:"result"`
+}
+
+func (client *Client) batchHTTP(c context.Context, calls []*Call) error {
+	reqs := make([]transactionRequest, len(calls))
+	for i, call := range calls {
+		reqs[i] = transactionRequest{call.Action, call.Method, call.Args, "rpc", i + 1}
+	}
+	body, err := json.Marshal(reqs)
+	if err != nil {
+		return err
+	}
+
+	r, err := http.NewRequest("POST", client.Provider.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if c != nil {
+		r = r.WithContext(c)
+	}
+	for key, values := range client.Header {
+		r.Header[key] = values
+	}
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	client.Provider.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		return fmt.Errorf("unexpected status %v: %s", w.Code, w.Body.String())
+	}
+
+	var resps []transactionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resps); err != nil {
+		return err
+	}
+	for _, resp := range resps {
+		if resp.Type == "event" {
+			continue
+		}
+		if resp.Tid < 1 || resp.Tid > len(calls) {
+			return fmt.Errorf("unexpected response tid %v", resp.Tid)
+		}
+		call := calls[resp.Tid - 1]
+		if resp.Type == "exception" {
+			call.Err = extdirect.ErrException{Action: resp.Action, Method: resp.Method, Message: resp.Message}
+		} else if call.Result != nil {
+			if err := json.Unmarshal(resp.Result, call.Result); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// assign stores value into value pointed by result directly if types are assignable or through JSON otherwise.
+func assign(result interface{}, value interface{}) error {
+	if result == nil {
+		return nil
+	}
+	target := reflect.ValueOf(result)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fmt.Errorf("result must be non-nil pointer, got %T", result)
+	}
+	if value == nil {
+		target.Elem().Set(reflect.Zero(target.Elem().Type()))
+		return nil
+	}
+	if v := reflect.ValueOf(value); v.Type().AssignableTo(target.Elem().Type()) {
+		target.Elem().Set(v)
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
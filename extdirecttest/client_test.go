@@ -0,0 +1,93 @@
+package extdirecttest
+
+import (
+	"testing"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/nbgo/extdirect"
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type Geometry struct {
+	C context.Context
+	R *http.Request
+}
+
+func (this Geometry) Move(p Point, dx int, dy int) *Point {
+	return &Point{p.X + dx, p.Y + dy}
+}
+func (this Geometry) User() string {
+	var result string
+	if v, ok := this.C.Value("user").(string); ok {
+		result += v
+	}
+	if this.R != nil {
+		result += this.R.Header.Get("X-Test")
+	}
+	return result
+}
+func (this Geometry) Fail() error {
+	return errors.New("failed")
+}
+
+func TestClient(t *testing.T) {
+	for _, viaHTTP := range []bool{false, true} {
+		Convey("Client with HTTP=" + map[bool]string{false: "false", true: "true"}[viaHTTP], t, func() {
+			provider := extdirect.NewProvider()
+			provider.RegisterAction(reflect.TypeOf(Geometry{}))
+			client := NewClient(provider)
+			client.HTTP = viaHTTP
+			client.Header = http.Header{"X-Test": []string{"!"}}
+			c := context.WithValue(context.Background(), "user", "TestUser")
+
+			Convey("calls method with typed result", func() {
+				var p Point
+				So(client.Call(c, "Geometry", "move", &p, Point{1, 2}, 10, 20), ShouldBeNil)
+				So(p, ShouldResemble, Point{11, 22})
+			})
+
+			Convey("passes context to method", func() {
+				var user string
+				So(client.Call(c, "Geometry", "user", &user), ShouldBeNil)
+				if viaHTTP {
+					So(user, ShouldEqual, "TestUser!")
+				} else {
+					So(user, ShouldEqual, "TestUser")
+				}
+			})
+
+			Convey("returns exception", func() {
+				err := client.Call(c, "Geometry", "fail", nil)
+				So(err, ShouldResemble, extdirect.ErrException{Action: "Geometry", Method: "fail", Message: "failed"})
+			})
+
+			Convey("returns exception of unknown method", func() {
+				err := client.Call(c, "Geometry", "unknown", nil)
+				So(err, ShouldResemble, extdirect.ErrException{Action: "Geometry", Method: "unknown", Message: "unknown direct method Geometry.unknown"})
+			})
+
+			Convey("calls batch", func() {
+				var p *Point
+				var user string
+				calls := []*Call{
+					{Action: "Geometry", Method: "move", Args: []interface{}{Point{0, 0}, 1, 1}, Result: &p},
+					{Action: "Geometry", Method: "fail"},
+					{Action: "Geometry", Method: "user", Result: &user},
+				}
+				So(client.Batch(c, calls...), ShouldBeNil)
+				So(*p, ShouldResemble, Point{1, 1})
+				So(calls[0].Err, ShouldBeNil)
+				So(calls[1].Err, ShouldResemble, extdirect.ErrException{Action: "Geometry", Method: "fail", Message: "failed"})
+				So(calls[2].Err, ShouldBeNil)
+				So(user, ShouldStartWith, "TestUser")
+			})
+		})
+	}
+}
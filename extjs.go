@@ -0,0 +1,186 @@
+package extdirect
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// ExtModelConfig configures generation of Ext JS model and store for records of direct action.
+type ExtModelConfig struct {
+	// Model is a class name of model, e.g. "App.model.User".
+	Model string
+	// Store is a class name of store, e.g. "App.store.Users". Store is not generated if empty.
+	Store string
+	// Action is a name of registered action with CRUD methods.
+	Action string
+	// Read, Create, Update and Destroy are direct method names of CRUD operations. Empty ones are omitted.
+	Read    string
+	Create  string
+	Update  string
+	Destroy string
+	// Record is a type of record. If nil it is inferred from result of read method: element type of slice result
+	// or of slice field named by RootProperty in struct result.
+	Record reflect.Type
+	// RootProperty and TotalProperty configure reader of proxy for struct results.
+	RootProperty  string
+	TotalProperty string
+}
+
+// ErrRecordTypeUnknown occurs when record type of Ext JS model cannot be inferred from read method result.
+type ErrRecordTypeUnknown string
+
+func (err ErrRecordTypeUnknown) Error() string {
+	return fmt.Sprintf("cannot infer record type from result of %s", string(err))
+}
+
+// ErrNoReadMethod occurs when Ext JS model of action has neither record type nor read method to infer it from.
+type ErrNoReadMethod string
+
+func (err ErrNoReadMethod) Error() string {
+	return fmt.Sprintf("cannot infer record type of %s without read method, set Record or Read of model config", string(err))
+}
+
+// ExtModel returns JavaScript definition of Ext.data.Model with fields of record type and direct proxy
+// and optionally Ext.data.Store using the model.
+// Field with `idproperty:"true"` tag becomes idProperty of model.
+func (provider *DirectServiceProvider) ExtModel(config ExtModelConfig) (string, error) {
+	actionInfo, ok := provider.actionsInfo[config.Action]
+	if !ok {
+		return "", ErrUnknownMethod{config.Action, ""}
+	}
+
+	api := &bytes.Buffer{}
+	for _, operation := range []struct{ name, method string }{
+		{"read", config.Read},
+		{"create", config.Create},
+		{"update", config.Update},
+		{"destroy", config.Destroy},
+	} {
+		if operation.method == "" {
+			continue
+		}
+		if _, ok := actionInfo.Methods[operation.method]; !ok {
+			return "", ErrUnknownMethod{config.Action, operation.method}
+		}
+		if api.Len() > 0 {
+			api.WriteString(",\n")
+		}
+		fmt.Fprintf(api, "            %s: %s", operation.name, jsString(provider.Namespace + "." + config.Action + "." + operation.method))
+	}
+
+	recordType := config.Record
+	if recordType == nil {
+		if config.Read == "" {
+			return "", ErrNoReadMethod(config.Action)
+		}
+		var err error
+		if recordType, err = provider.readRecordType(config); err != nil {
+			return "", err
+		}
+	}
+	for recordType.Kind() == reflect.Ptr {
+		recordType = recordType.Elem()
+	}
+	if recordType.Kind() != reflect.Struct {
+		return "", ErrRecordTypeUnknown(config.Action + "." + config.Read)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "Ext.define(%s, {\n    extend: \"Ext.data.Model\",\n", jsString(config.Model))
+	fields := jsonFields(recordType)
+	for _, f := range fields {
+		if f.Tag.Get("idproperty") == "true" {
+			fmt.Fprintf(buf, "    idProperty: %s,\n", jsString(f.Name))
+		}
+	}
+	buf.WriteString("    fields: [\n")
+	for i, f := range fields {
+		fmt.Fprintf(buf, "        {name: %s, %s}", jsString(f.Name), extFieldType(f.Type))
+		if i < len(fields) - 1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("    ],\n")
+	buf.WriteString("    proxy: {\n        type: \"direct\",\n        api: {\n")
+	buf.Write(api.Bytes())
+	buf.WriteString("\n        }")
+	if config.RootProperty != "" || config.TotalProperty != "" {
+		buf.WriteString(",\n        reader: {\n            type: \"json\"")
+		if config.RootProperty != "" {
+			fmt.Fprintf(buf, ",\n            rootProperty: %s", jsString(config.RootProperty))
+		}
+		if config.TotalProperty != "" {
+			fmt.Fprintf(buf, ",\n            totalProperty: %s", jsString(config.TotalProperty))
+		}
+		buf.WriteString("\n        }")
+	}
+	buf.WriteString("\n    }\n});\n")
+
+	if config.Store != "" {
+		fmt.Fprintf(buf, "Ext.define(%s, {\n    extend: \"Ext.data.Store\",\n    model: %s\n});\n", jsString(config.Store), jsString(config.Model))
+	}
+	return buf.String(), nil
+}
+
+// readRecordType infers record type from result of read method.
+func (provider *DirectServiceProvider) readRecordType(config ExtModelConfig) (reflect.Type, error) {
+	methodInfo, ok := provider.actionsInfo[config.Action].Methods[config.Read]
+	if !ok {
+		return nil, ErrUnknownMethod{config.Action, config.Read}
+	}
+	for i := methodInfo.Type.NumOut() - 1; i >= 0; i-- {
+		t := methodInfo.Type.Out(i)
+		if t == errorType {
+			continue
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Slice {
+			return t.Elem(), nil
+		}
+		if t.Kind() == reflect.Struct && config.RootProperty != "" {
+			for _, f := range jsonFields(t) {
+				if f.Name == config.RootProperty && f.Type.Kind() == reflect.Slice {
+					return f.Type.Elem(), nil
+				}
+			}
+		}
+		break
+	}
+	return nil, ErrRecordTypeUnknown(config.Action + "." + config.Read)
+}
+
+// extFieldType returns Ext.data.field.Field type config for Go type.
+func extFieldType(t reflect.Type) string {
+	allowNull := ""
+	if t.Kind() == reflect.Ptr {
+		allowNull = ", allowNull: true"
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+	if t == timeType {
+		return `type: "date", dateFormat: "c"` + allowNull
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return `type: "boolean"` + allowNull
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return `type: "int"` + allowNull
+	case reflect.Float32, reflect.Float64:
+		return `type: "number"` + allowNull
+	case reflect.String:
+		return `type: "string"` + allowNull
+	}
+	return `type: "auto"`
+}
+
+func jsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
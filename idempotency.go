@@ -0,0 +1,84 @@
+package extdirect
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// IdempotencyKeyHeader is a header with idempotency key of transaction.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotency replays stored results of calls repeated with the same idempotency key.
+type idempotency struct {
+	store    Cache
+	ttl      time.Duration
+	mutex    sync.Mutex
+	inFlight map[string]chan struct{}
+}
+
+type idempotencyMetadata struct {
+	IdempotencyKey string `json:"idempotencyKey"`
+}
+
+// SetIdempotency enables replay of results of calls repeated (e.g. retried by Ext client after timeout) with
+// the same idempotency key instead of calling methods again. Key of call is either idempotencyKey property
+// of call metadata or Idempotency-Key header of transaction combined with tid of call. Successful results are
+// kept in store (e.g. NewLRUCache(1000)) for ttl; exceptions are not stored, so failed calls are executed again.
+// Duplicate arriving while call is in progress waits for its result. Nil store disables idempotency.
+func (provider *DirectServiceProvider) SetIdempotency(store Cache, ttl time.Duration) {
+	if store == nil {
+		provider.idempotency = nil
+		return
+	}
+	provider.idempotency = &idempotency{store: store, ttl: ttl, inFlight: make(map[string]chan struct{})}
+}
+
+// idempotencyKey returns store key of call scoped by user and method or empty string if call has no idempotency key.
+func (provider *DirectServiceProvider) idempotencyKey(c context.Context, r *http.Request, req *request) string {
+	if provider.idempotency == nil {
+		return ""
+	}
+	key := ""
+	var metadata idempotencyMetadata
+	if len(req.Metadata) > 0 && provider.codec.Unmarshal(req.Metadata, &metadata) == nil && metadata.IdempotencyKey != "" {
+		key = metadata.IdempotencyKey
+	} else if r != nil && r.Header.Get(IdempotencyKeyHeader) != "" {
+		key = r.Header.Get(IdempotencyKeyHeader) + "\x00" + strconv.Itoa(req.Tid)
+	} else {
+		return ""
+	}
+	return provider.user(c, r) + "\x00" + req.Action + "." + req.Method + "\x00" + key
+}
+
+// begin returns stored result of key or reserves key for call returning false. It waits while call of key is in progress.
+func (idempotency *idempotency) begin(key string) (interface{}, bool) {
+	for {
+		idempotency.mutex.Lock()
+		if result, ok := idempotency.store.Get(key); ok {
+			idempotency.mutex.Unlock()
+			return result, true
+		}
+		done, inFlight := idempotency.inFlight[key]
+		if !inFlight {
+			idempotency.inFlight[key] = make(chan struct{})
+			idempotency.mutex.Unlock()
+			return nil, false
+		}
+		idempotency.mutex.Unlock()
+		<-done
+	}
+}
+
+// end stores result of successful call of reserved key and releases waiting duplicates.
+func (idempotency *idempotency) end(key string, resp *response) {
+	idempotency.mutex.Lock()
+	defer idempotency.mutex.Unlock()
+	if resp.Type != "exception" {
+		idempotency.store.Set(key, resp.Result, idempotency.ttl)
+	}
+	close(idempotency.inFlight[key])
+	delete(idempotency.inFlight, key)
+}
@@ -1,6 +1,7 @@
 package extdirect
 import (
 	stdlog "log"
+	"log/slog"
 	"os"
 	"github.com/Sirupsen/logrus"
 	"strings"
@@ -8,85 +9,190 @@ import (
 	"fmt"
 )
 
-type logger interface {
-	Print(v ...interface{})
+// Logger is a leveled structured logger.
+// Fields are passed as alternating keys and values like in log/slog.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
 }
 
 const (
-	logLevelInfo = "info: "
-	logLevelWarn = "warn: "
+	logLevelDebug = "debug: "
+	logLevelInfo  = "info: "
+	logLevelWarn  = "warn: "
+	logLevelError = "error: "
 )
 
-var log logger = stdlog.New(os.Stderr, "", stdlog.LstdFlags)
+var defaultLogger Logger = &StdLogger{stdlog.New(os.Stderr, "", stdlog.LstdFlags)}
 
-// SetLogger sets custom logger for package.
-func SetLogger(l logger) {
-	log = l
+// SetLogger sets default logger for providers without own logger.
+//
+// Deprecated: use DirectServiceProvider.SetLogger instead.
+func SetLogger(l Logger) {
+	defaultLogger = l
 }
 
-// LogrusLogger is a logrus implementation of internal logger.
-type LogrusLogger struct {
-	L *logrus.Entry
+// SetLogger sets logger for provider.
+func (provider *DirectServiceProvider) SetLogger(l Logger) {
+	provider.logger = l
 }
 
-// Print implements internal logger Print method for logrus.
-func (logrusWrapper *LogrusLogger) Print(v ...interface{}) {
-	defer func() {
-		if err := recover(); err != nil {
-			stdlog.Panicf("Logging error: %v", err)
+func (provider *DirectServiceProvider) log() Logger {
+	if provider.logger != nil {
+		return provider.logger
+	}
+	return defaultLogger
+}
+
+// logFields converts alternating keys and values into map.
+func logFields(keysAndValues []interface{}) map[string]interface{} {
+	fields := make(map[string]interface{}, len(keysAndValues) / 2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := fmt.Sprintf("%v", keysAndValues[i])
+		if i + 1 < len(keysAndValues) {
+			fields[key] = keysAndValues[i + 1]
+		} else {
+			fields["!BADKEY"] = keysAndValues[i]
 		}
-	}()
-	if len(v) == 0 {
-		return
 	}
-	l := logrusWrapper.L
-	if len(v) == 1 {
-		if err, errOk := v[0].(error); errOk {
-			if err2, err2Ok := fail.GetOriginalError(err).(*ErrDirectActionMethod); err2Ok {
-				var stackTrace string
-				if err3, err3Ok := err2.Err.(error); err3Ok {
-					stackTrace = fail.GetStackTrace(err3)
-				}
-
-				if stackTrace == "" {
-					stackTraceSkip := 1
-					if err2.isPanic {
-						stackTraceSkip = 4
-					}
-					stackTrace = fail.StackTrace(stackTraceSkip)
-				}
-
-				l = l.WithFields(logrus.Fields{
-					"action": err2.Action,
-					"method": err2.Method,
-					"stack": stackTrace,
-				})
-			} else {
-				stackTrace := fail.GetStackTrace(err)
-				if stackTrace == "" {
-					stackTrace = fail.StackTrace(1)
-				}
-
-				l = l.WithFields(logrus.Fields{
-					"stack": stackTrace,
-				})
-			}
+	return fields
+}
+
+// StdLogger is a standard library implementation of Logger.
+type StdLogger struct {
+	L *stdlog.Logger
+}
+
+var _ Logger = &StdLogger{}
 
-			l.Error(err)
+func (stdWrapper *StdLogger) print(level string, msg string, keysAndValues []interface{}) {
+	s := level + msg
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i + 1 < len(keysAndValues) {
+			s += fmt.Sprintf(" %v=%v", keysAndValues[i], keysAndValues[i + 1])
 		} else {
-			l.Debug(v[0])
+			s += fmt.Sprintf(" !BADKEY=%v", keysAndValues[i])
 		}
-	} else {
-		if len(v) > 2 {
-			l = l.WithFields(v[2].(map[string]interface{}))
+	}
+	stdWrapper.L.Print(s)
+}
+
+// Debug implements Logger.Debug().
+func (stdWrapper *StdLogger) Debug(msg string, keysAndValues ...interface{}) {
+	stdWrapper.print(logLevelDebug, msg, keysAndValues)
+}
+
+// Info implements Logger.Info().
+func (stdWrapper *StdLogger) Info(msg string, keysAndValues ...interface{}) {
+	stdWrapper.print(logLevelInfo, msg, keysAndValues)
+}
+
+// Warn implements Logger.Warn().
+func (stdWrapper *StdLogger) Warn(msg string, keysAndValues ...interface{}) {
+	stdWrapper.print(logLevelWarn, msg, keysAndValues)
+}
+
+// Error implements Logger.Error().
+func (stdWrapper *StdLogger) Error(msg string, keysAndValues ...interface{}) {
+	stdWrapper.print(logLevelError, msg, keysAndValues)
+}
+
+// SlogLogger is a log/slog implementation of Logger.
+type SlogLogger struct {
+	L *slog.Logger
+}
+
+var _ Logger = &SlogLogger{}
+
+// Debug implements Logger.Debug().
+func (slogWrapper *SlogLogger) Debug(msg string, keysAndValues ...interface{}) {
+	slogWrapper.L.Debug(msg, keysAndValues...)
+}
+
+// Info implements Logger.Info().
+func (slogWrapper *SlogLogger) Info(msg string, keysAndValues ...interface{}) {
+	slogWrapper.L.Info(msg, keysAndValues...)
+}
+
+// Warn implements Logger.Warn().
+func (slogWrapper *SlogLogger) Warn(msg string, keysAndValues ...interface{}) {
+	slogWrapper.L.Warn(msg, keysAndValues...)
+}
+
+// Error implements Logger.Error().
+func (slogWrapper *SlogLogger) Error(msg string, keysAndValues ...interface{}) {
+	slogWrapper.L.Error(msg, keysAndValues...)
+}
+
+// LogrusLogger is a logrus implementation of Logger.
+// Error values passed with "error" key get their stack trace logged with "stack" key.
+type LogrusLogger struct {
+	L *logrus.Entry
+}
+
+var _ Logger = &LogrusLogger{}
+
+func (logrusWrapper *LogrusLogger) entry(keysAndValues []interface{}) *logrus.Entry {
+	if len(keysAndValues) == 0 {
+		return logrusWrapper.L
+	}
+	return logrusWrapper.L.WithFields(logrus.Fields(logFields(keysAndValues)))
+}
+
+// Debug implements Logger.Debug().
+func (logrusWrapper *LogrusLogger) Debug(msg string, keysAndValues ...interface{}) {
+	logrusWrapper.entry(keysAndValues).Debug(strings.TrimSpace(msg))
+}
+
+// Info implements Logger.Info().
+func (logrusWrapper *LogrusLogger) Info(msg string, keysAndValues ...interface{}) {
+	logrusWrapper.entry(keysAndValues).Info(strings.TrimSpace(msg))
+}
+
+// Warn implements Logger.Warn().
+func (logrusWrapper *LogrusLogger) Warn(msg string, keysAndValues ...interface{}) {
+	logrusWrapper.entry(keysAndValues).Warn(strings.TrimSpace(msg))
+}
+
+// Error implements Logger.Error().
+func (logrusWrapper *LogrusLogger) Error(msg string, keysAndValues ...interface{}) {
+	l := logrusWrapper.entry(keysAndValues)
+	if err, errOk := l.Data["error"].(error); errOk {
+		l = l.WithField("stack", errorStackTrace(err))
+	}
+	l.Error(strings.TrimSpace(msg))
+}
+
+func errorStackTrace(err error) string {
+	var err2 *ErrDirectActionMethod
+	switch originalErr := fail.GetOriginalError(err).(type) {
+	case ErrDirectActionMethod:
+		err2 = &originalErr
+	case *ErrDirectActionMethod:
+		err2 = originalErr
+	}
+
+	if err2 != nil {
+		var stackTrace string
+		if err3, err3Ok := err2.Err.(error); err3Ok {
+			stackTrace = fail.GetStackTrace(err3)
 		}
 
-		m := strings.TrimSpace(v[1].(string))
-		logLevel := v[0].(string)
-		switch logLevel {
-		case logLevelInfo: l.Info(m)
-		case logLevelWarn: l.Warn(m)
-		default: panic(fmt.Errorf("Unknown log message type: '%v.", logLevel))
+		if stackTrace == "" {
+			stackTraceSkip := 2
+			if err2.isPanic {
+				stackTraceSkip = 5
+			}
+			stackTrace = fail.StackTrace(stackTraceSkip)
 		}
+		return stackTrace
 	}
-}
\ No newline at end of file
+
+	stackTrace := fail.GetStackTrace(err)
+	if stackTrace == "" {
+		stackTrace = fail.StackTrace(2)
+	}
+	return stackTrace
+}
@@ -0,0 +1,80 @@
+package extdirect
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// DirectMetadata is embedded into struct type of the last direct method parameter to receive call metadata
+// (sent by Ext JS 5+ for methods with metadata declared) instead of call data argument.
+// Example: func (this Db) Load(id int, m *LoadMetadata) where LoadMetadata embeds DirectMetadata.
+type DirectMetadata struct{}
+
+// directMetadata is a metadata declaration of direct method: either number of metadata array items
+// (`metadatalen:"2"` tag) or names of metadata object properties (`metadataparams:"id,name"` tag).
+type directMetadata struct {
+	Len    *int     `json:"len,omitempty"`
+	Params []string `json:"params,omitempty"`
+}
+
+var directMetadataType = reflect.TypeOf(DirectMetadata{})
+
+type metadataKey struct{}
+
+type callMetadata struct {
+	data  json.RawMessage
+	codec Codec
+}
+
+// metadataFromTag returns metadata declaration of direct method from its tags or nil if it has none.
+func metadataFromTag(tag reflect.StructTag) *directMetadata {
+	if params := tag.Get("metadataparams"); params != "" {
+		return &directMetadata{Params: strings.Split(params, ",")}
+	}
+	if n, err := strconv.Atoi(tag.Get("metadatalen")); err == nil {
+		return &directMetadata{Len: &n}
+	}
+	return nil
+}
+
+// isMetadataParam reports whether parameter type is a (pointer to) struct embedding DirectMetadata.
+func isMetadataParam(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.Anonymous && f.Type == directMetadataType {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMetadataParam reports whether the last parameter of method receives call metadata.
+func hasMetadataParam(methodType reflect.Type) bool {
+	return methodType.NumIn() > 1 && isMetadataParam(methodType.In(methodType.NumIn() - 1))
+}
+
+// withMetadata returns context carrying call metadata. Nil context is replaced with background one.
+func withMetadata(c context.Context, data json.RawMessage, codec Codec) context.Context {
+	return context.WithValue(contextOrBackground(c), metadataKey{}, &callMetadata{data, codec})
+}
+
+// DecodeMetadata decodes metadata of direct method call into v. Context must be the one set to action of the method.
+// It returns false if call has no metadata.
+func DecodeMetadata(c context.Context, v interface{}) (bool, error) {
+	if c == nil {
+		return false, nil
+	}
+	metadata, ok := c.Value(metadataKey{}).(*callMetadata)
+	if !ok {
+		return false, nil
+	}
+	return true, metadata.codec.Unmarshal(metadata.data, v)
+}
@@ -0,0 +1,243 @@
+package extdirect
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CallStatus is an outcome of direct method call.
+type CallStatus string
+
+const (
+	// CallSuccess is status of call completed without error.
+	CallSuccess CallStatus = "success"
+
+	// CallError is status of call which returned error.
+	CallError CallStatus = "error"
+
+	// CallPanic is status of call which panicked.
+	CallPanic CallStatus = "panic"
+)
+
+// MetricsSink receives metrics of direct method calls.
+// Only calls of registered methods are reported.
+type MetricsSink interface {
+	// CallStarted is called before direct method call is processed.
+	CallStarted(action, method string)
+	// CallFinished is called after direct method call is processed.
+	CallFinished(action, method string, duration time.Duration, status CallStatus)
+	// BatchReceived is called for every transaction with number of calls in it.
+	BatchReceived(size int)
+}
+
+// SetMetrics sets sink receiving metrics of provider.
+func (provider *DirectServiceProvider) SetMetrics(metrics MetricsSink) {
+	provider.metrics = metrics
+}
+
+// DefaultDurationBuckets are default upper bounds (in seconds) of call latency histogram buckets.
+var DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultBatchSizeBuckets are default upper bounds of batch size histogram buckets.
+var DefaultBatchSizeBuckets = []float64{1, 2, 5, 10, 20, 50, 100}
+
+type methodKey struct {
+	action string
+	method string
+}
+
+type callKey struct {
+	methodKey
+	status CallStatus
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, upperBound := range h.buckets {
+		if v <= upperBound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// PrometheusMetrics is in-memory MetricsSink exposing metrics in Prometheus text format by ServeHTTP.
+type PrometheusMetrics struct {
+	sync.Mutex
+	DurationBuckets  []float64
+	BatchSizeBuckets []float64
+	calls            map[callKey]uint64
+	inFlight         map[methodKey]int64
+	durations        map[methodKey]*histogram
+	batchSizes       *histogram
+}
+
+var _ MetricsSink = &PrometheusMetrics{}
+var _ http.Handler = &PrometheusMetrics{}
+
+// NewPrometheusMetrics creates new Prometheus metrics with default buckets.
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{
+		DurationBuckets: DefaultDurationBuckets,
+		BatchSizeBuckets: DefaultBatchSizeBuckets,
+		calls: make(map[callKey]uint64),
+		inFlight: make(map[methodKey]int64),
+		durations: make(map[methodKey]*histogram),
+	}
+}
+
+// CallStarted implements MetricsSink.CallStarted().
+func (metrics *PrometheusMetrics) CallStarted(action, method string) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.inFlight[methodKey{action, method}]++
+}
+
+// CallFinished implements MetricsSink.CallFinished().
+func (metrics *PrometheusMetrics) CallFinished(action, method string, duration time.Duration, status CallStatus) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	key := methodKey{action, method}
+	metrics.inFlight[key]--
+	metrics.calls[callKey{key, status}]++
+	h, ok := metrics.durations[key]
+	if !ok {
+		h = newHistogram(metrics.DurationBuckets)
+		metrics.durations[key] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// BatchReceived implements MetricsSink.BatchReceived().
+func (metrics *PrometheusMetrics) BatchReceived(size int) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	if metrics.batchSizes == nil {
+		metrics.batchSizes = newHistogram(metrics.BatchSizeBuckets)
+	}
+	metrics.batchSizes.observe(float64(size))
+}
+
+// ServeHTTP writes metrics in Prometheus text exposition format.
+func (metrics *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := w.Write([]byte(metrics.Text())); err != nil {
+		panic(err)
+	}
+}
+
+// Text returns metrics in Prometheus text exposition format.
+func (metrics *PrometheusMetrics) Text() string {
+	metrics.Lock()
+	defer metrics.Unlock()
+	buf := &bytes.Buffer{}
+
+	writeMetricHeader(buf, "extdirect_calls_total", "counter", "Total number of direct method calls by status.")
+	callKeys := make([]callKey, 0, len(metrics.calls))
+	for key := range metrics.calls {
+		callKeys = append(callKeys, key)
+	}
+	sort.Slice(callKeys, func(i, j int) bool {
+		if callKeys[i].methodKey != callKeys[j].methodKey {
+			return methodKeyLess(callKeys[i].methodKey, callKeys[j].methodKey)
+		}
+		return callKeys[i].status < callKeys[j].status
+	})
+	for _, key := range callKeys {
+		fmt.Fprintf(buf, "extdirect_calls_total{%s,status=%s} %d\n", methodLabels(key.methodKey), quoteLabel(string(key.status)), metrics.calls[key])
+	}
+
+	writeMetricHeader(buf, "extdirect_calls_in_flight", "gauge", "Number of direct method calls being processed.")
+	for _, key := range sortedMethodKeys(metrics.inFlight) {
+		fmt.Fprintf(buf, "extdirect_calls_in_flight{%s} %d\n", methodLabels(key), metrics.inFlight[key])
+	}
+
+	writeMetricHeader(buf, "extdirect_call_duration_seconds", "histogram", "Latency of direct method calls.")
+	for _, key := range sortedMethodKeys(metrics.durations) {
+		writeHistogram(buf, "extdirect_call_duration_seconds", methodLabels(key) + ",", metrics.durations[key])
+	}
+
+	writeMetricHeader(buf, "extdirect_batch_size", "histogram", "Number of direct method calls per transaction.")
+	if metrics.batchSizes != nil {
+		writeHistogram(buf, "extdirect_batch_size", "", metrics.batchSizes)
+	}
+
+	return buf.String()
+}
+
+func writeMetricHeader(buf *bytes.Buffer, name, metricType, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func writeHistogram(buf *bytes.Buffer, name string, labels string, h *histogram) {
+	for i, upperBound := range h.buckets {
+		fmt.Fprintf(buf, "%s_bucket{%sle=%s} %d\n", name, labels, quoteLabel(formatFloat(upperBound)), h.counts[i])
+	}
+	fmt.Fprintf(buf, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, h.count)
+	labels = strings.TrimSuffix(labels, ",")
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(buf, "%s_sum%s %s\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(buf, "%s_count%s %d\n", name, labels, h.count)
+}
+
+func sortedMethodKeys(m interface{}) []methodKey {
+	var keys []methodKey
+	switch m := m.(type) {
+	case map[methodKey]int64:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[methodKey]*histogram:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return methodKeyLess(keys[i], keys[j])
+	})
+	return keys
+}
+
+func methodKeyLess(a, b methodKey) bool {
+	if a.action != b.action {
+		return a.action < b.action
+	}
+	return a.method < b.method
+}
+
+func methodLabels(key methodKey) string {
+	return fmt.Sprintf("action=%s,method=%s", quoteLabel(key.action), quoteLabel(key.method))
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(s string) string {
+	return `"` + labelReplacer.Replace(s) + `"`
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
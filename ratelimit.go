@@ -0,0 +1,173 @@
+package extdirect
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited occurs when client exceeds rate limit of direct method.
+type ErrRateLimited struct {
+	Action     string
+	Method     string
+	RetryAfter time.Duration
+}
+
+func (err ErrRateLimited) Error() string {
+	return fmt.Sprintf("rate limit of %v.%v exceeded, retry after %v", err.Action, err.Method, err.RetryAfter)
+}
+
+// RateLimiter decides whether call of client identified by key is allowed by limit of calls per period.
+// If call is not allowed, it returns time after which call would be allowed.
+type RateLimiter interface {
+	Allow(key string, limit int, per time.Duration) (bool, time.Duration)
+}
+
+// ClientIDFunc identifies client of direct method call for rate limiting, e.g. by IP, user or session.
+// Request is nil for calls made in process. Calls of clients with empty id are not rate limited.
+type ClientIDFunc func(c context.Context, r *http.Request) string
+
+// rateLimit is a limit of direct method calls declared by `ratelimit:"<count>/<period>"` tag,
+// e.g. "10/m", "100/h", "5/30s" or "1000/d". Period is duration accepted by time.ParseDuration
+// or number of days with "d" unit, its number may be omitted for 1. Invalid tag panics on registration.
+type rateLimit struct {
+	count int
+	per   time.Duration
+}
+
+// parseRateLimit parses ratelimit tag value.
+func parseRateLimit(s string) (*rateLimit, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid rate limit %q", s)
+	}
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count <= 0 {
+		return nil, fmt.Errorf("invalid rate limit count %q", s)
+	}
+	period := parts[1]
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	var per time.Duration
+	if strings.HasSuffix(period, "d") {
+		var days int
+		if days, err = strconv.Atoi(strings.TrimSuffix(period, "d")); err == nil {
+			per = time.Duration(days) * 24 * time.Hour
+		}
+	} else {
+		per, err = time.ParseDuration(period)
+	}
+	if err != nil || per <= 0 {
+		return nil, fmt.Errorf("invalid rate limit period %q", s)
+	}
+	return &rateLimit{count, per}, nil
+}
+
+// SetRateLimiter sets limiter of calls to methods with ratelimit tag (in-memory token buckets by default).
+// Nil disables rate limiting.
+func (provider *DirectServiceProvider) SetRateLimiter(limiter RateLimiter) {
+	provider.rateLimiter = limiter
+}
+
+// SetClientIDFunc sets function identifying clients for rate limiting. By default clients are identified
+// by user if UserFunc is set or by IP address of request otherwise, so calls made in process without user
+// are not rate limited.
+func (provider *DirectServiceProvider) SetClientIDFunc(clientIDFunc ClientIDFunc) {
+	provider.clientIDFunc = clientIDFunc
+}
+
+func (provider *DirectServiceProvider) clientID(c context.Context, r *http.Request) string {
+	if provider.clientIDFunc != nil {
+		return provider.clientIDFunc(c, r)
+	}
+	if provider.userFunc != nil {
+		return provider.user(c, r)
+	}
+	if r == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// rateLimited checks rate limit of direct method call and returns error if it is exceeded or nil otherwise.
+func (provider *DirectServiceProvider) rateLimited(c context.Context, r *http.Request, action, method string) *ErrRateLimited {
+	limit := provider.actionsInfo[action].DirectMethods[method].rateLimit
+	if limit == nil || provider.rateLimiter == nil {
+		return nil
+	}
+	clientID := provider.clientID(c, r)
+	if clientID == "" {
+		return nil
+	}
+	key := clientID + "|" + action + "." + method
+	if ok, retryAfter := provider.rateLimiter.Allow(key, limit.count, limit.per); !ok {
+		return &ErrRateLimited{action, method, retryAfter}
+	}
+	return nil
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+// TokenBucketLimiter is an in-memory RateLimiter with token bucket per key: bucket holds up to limit tokens
+// refilled at rate limit per period, and every call takes a token.
+type TokenBucketLimiter struct {
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+	cleaned time.Time
+	now     func() time.Time
+}
+
+// NewTokenBucketLimiter creates in-memory token bucket limiter.
+func NewTokenBucketLimiter() *TokenBucketLimiter {
+	return &TokenBucketLimiter{buckets: make(map[string]*tokenBucket), now: time.Now}
+}
+
+// Allow implements RateLimiter.
+func (limiter *TokenBucketLimiter) Allow(key string, limit int, per time.Duration) (bool, time.Duration) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	now := limiter.now()
+	limiter.cleanup(now)
+	rate := float64(limit) / float64(per)
+
+	bucket, ok := limiter.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit), updated: now}
+		limiter.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(limit), bucket.tokens + float64(now.Sub(bucket.updated)) * rate)
+	bucket.updated = now
+	if bucket.tokens < 1 {
+		return false, time.Duration(math.Ceil((1 - bucket.tokens) / rate))
+	}
+	bucket.tokens--
+	bucket.full = now.Add(time.Duration((float64(limit) - bucket.tokens) / rate))
+	return true, 0
+}
+
+// cleanup removes buckets refilled to full (equivalent to missing ones) once a minute.
+func (limiter *TokenBucketLimiter) cleanup(now time.Time) {
+	if now.Sub(limiter.cleaned) < time.Minute {
+		return
+	}
+	limiter.cleaned = now
+	for key, bucket := range limiter.buckets {
+		if !now.Before(bucket.full) {
+			delete(limiter.buckets, key)
+		}
+	}
+}
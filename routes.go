@@ -9,10 +9,12 @@ import (
 	"encoding/json"
 	"reflect"
 	"time"
-	"golang.org/x/net/context"
+	"context"
 	"net/url"
 	"strconv"
 	"github.com/nbgo/fail"
+	"sync/atomic"
+	"math"
 )
 
 // ErrDecodeFromPostRequest has information about decoding error.
@@ -50,6 +52,19 @@ func (err ErrDirectActionMethod) Error() string {
 	return fmt.Sprintf("error executing %v.%v(): %v", err.Action, err.Method, err.Err)
 }
 
+// ErrUnknownMethod occurs when direct action or its method is not registered.
+type ErrUnknownMethod struct {
+	Action string
+	Method string
+}
+
+func (err ErrUnknownMethod) Error() string {
+	if err.Method == "" {
+		return fmt.Sprintf("unknown direct action %v", err.Action)
+	}
+	return fmt.Sprintf("unknown direct method %v.%v", err.Action, err.Method)
+}
+
 type request struct {
 	Type     string            `json:"type"`
 	Tid      int               `json:"tid"`
@@ -57,6 +72,7 @@ type request struct {
 	Method   string            `json:"method"`
 	Upload   bool              `json:"upload"`
 	Data     json.RawMessage   `json:"data"`
+	Metadata json.RawMessage   `json:"metadata"`
 	FormData map[string]string `json:"-"`
 }
 
@@ -66,7 +82,27 @@ type response struct {
 	Action  string      `json:"action"`
 	Method  string      `json:"method"`
 	Message *string     `json:"message,omitempty"`
-	Result  interface{} `json:"result,omitempty"`
+	Result  interface{} `json:"result"`
+	// RetryAfter is a number of seconds after which rate limited call can be retried.
+	RetryAfter int      `json:"-"`
+}
+
+type exceptionResponse struct {
+	Type    string  `json:"type"`
+	Tid     int     `json:"tid"`
+	Action  string  `json:"action"`
+	Method  string  `json:"method"`
+	Message *string `json:"message,omitempty"`
+	RetryAfter int  `json:"retryAfter,omitempty"`
+}
+
+// encodable returns value to encode for response: result of successful response is always encoded
+// (even zero or nil one) while exception has no result.
+func (resp *response) encodable() interface{} {
+	if resp.Type == "exception" {
+		return &exceptionResponse{resp.Type, resp.Tid, resp.Action, resp.Method, resp.Message, resp.RetryAfter}
+	}
+	return resp
 }
 
 // API is routes for getting Ext.Direct API script.
@@ -76,17 +112,87 @@ func API(provider *DirectServiceProvider) func(w http.ResponseWriter, r *http.Re
 		if js, err := provider.JavaScript(); err != nil {
 			panic(err)
 		} else {
+			if provider.csrf != nil {
+				// Script carries token of session, so it must not be shared.
+				w.Header().Set("Cache-Control", "no-store")
+				js += provider.csrf.javaScript(w, r, provider.Namespace, provider.webSocket.url)
+			}
+			w, closeResponse := provider.compressResponse(w, r)
 			if _, err := w.Write([]byte(js)); err != nil {
 				panic(err)
 			}
+			closeResponse()
 		}
 	}
 }
 
-// ActionsHandler is route for handling Ext.Direct requests.
+// ServeHTTP implements http.Handler: GET request returns API script and POST request is handled
+// as Ext.Direct transaction with request context passed to actions.
+func (provider *DirectServiceProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD":
+		API(provider)(w, r)
+	case "POST":
+		actionHandler(provider, r.Context(), w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// Router registers handlers by pattern like http.ServeMux or chi.Router do. Routers with other Handle signature
+// (e.g. gorilla/mux or goji) are adapted by RouterFunc; routers registering handlers per HTTP method
+// (e.g. httprouter) are supported by MountMethods.
+type Router interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+var _ Router = http.NewServeMux()
+
+// RouterFunc adapts function registering handler by pattern to Router, e.g. for gorilla/mux router r:
+//	provider.Mount(extdirect.RouterFunc(func(pattern string, handler http.Handler) { r.Handle(pattern, handler) }))
+type RouterFunc func(pattern string, handler http.Handler)
+
+// Handle implements Router.
+func (f RouterFunc) Handle(pattern string, handler http.Handler) {
+	f(pattern, handler)
+}
+
+// MethodRouter registers handlers by HTTP method and path like httprouter.Router does.
+type MethodRouter interface {
+	Handler(method, path string, handler http.Handler)
+}
+
+// Mount registers provider in router at provider URL and its WebSocket and Server-Sent Events handlers
+// at their URLs if they are set.
+func (provider *DirectServiceProvider) Mount(router Router) {
+	router.Handle(provider.URL, provider)
+	if provider.webSocket.url != "" {
+		router.Handle(provider.webSocket.url, provider.WebSocketHandler())
+	}
+	if provider.eventStream.url != "" {
+		router.Handle(provider.eventStream.url, provider.EventStreamHandler())
+	}
+}
+
+// MountMethods registers provider in method router like Mount does: GET, HEAD and POST at provider URL
+// and GET at WebSocket and Server-Sent Events URLs if they are set.
+func (provider *DirectServiceProvider) MountMethods(router MethodRouter) {
+	for _, method := range []string{"GET", "HEAD", "POST"} {
+		router.Handler(method, provider.URL, provider)
+	}
+	if provider.webSocket.url != "" {
+		router.Handler("GET", provider.webSocket.url, provider.WebSocketHandler())
+	}
+	if provider.eventStream.url != "" {
+		router.Handler("GET", provider.eventStream.url, provider.EventStreamHandler())
+	}
+}
+
+// ActionsHandler is route for handling Ext.Direct requests with request context passed to actions.
 func ActionsHandler(provider *DirectServiceProvider) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		actionHandler(provider, nil, w, r)
+		actionHandler(provider, r.Context(), w, r)
 	}
 }
 
@@ -102,12 +208,17 @@ func actionHandler(provider *DirectServiceProvider, c context.Context, w http.Re
 	var err error
 	contentType := r.Header.Get("Content-Type")
 	isFormHandler := false
+	formToken := ""
 
 	switch {
 	case strings.HasPrefix(contentType, "application/json"):
-		reqs = mustDecodeTransaction(r.Body)
+		reqs = provider.mustDecodeTransaction(r.Body)
 	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
 		r.ParseForm()
+		if provider.csrf != nil {
+			formToken = r.Form.Get(provider.csrf.FieldName)
+			r.Form.Del(provider.csrf.FieldName)
+		}
 		reqs = mustDecodeFormPost(r.Form)
 		isFormHandler = true
 	default:
@@ -115,169 +226,432 @@ func actionHandler(provider *DirectServiceProvider, c context.Context, w http.Re
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w, closeResponse := provider.compressResponse(w, r)
+	// Form post response is single object, so events cannot be appended to it.
+	var events *eventQueue
+	if !isFormHandler {
+		c, events = withEventQueue(c)
+	}
+	var csrfErr error
+	if provider.csrf != nil {
+		if csrfErr = provider.csrf.verify(r, formToken); csrfErr != nil {
+			provider.log().Warn(csrfErr.Error(), "error", csrfErr)
+		}
+	}
+	if provider.stream && !isFormHandler && csrfErr == nil {
+		provider.streamResponses(w, provider.startRequests(c, r, reqs), events)
+		closeResponse()
+		return
+	}
+	var resps []*response
+	if csrfErr != nil {
+		resps = exceptionResponses(reqs, csrfErr)
+	} else {
+		resps = provider.processRequests(c, r, reqs)
+	}
+	var data []byte
 	if !isFormHandler {
-		err = json.NewEncoder(w).Encode(provider.processRequests(c, r, reqs))
+		data, err = provider.codec.Marshal(encodables(resps, events))
 	} else {
-		resps := provider.processRequests(c, r, reqs)
-		err = json.NewEncoder(w).Encode(resps[0])
+		data, err = provider.codec.Marshal(resps[0].encodable())
 	}
 	if err != nil {
 		panic(err)
 	}
+	if _, err = w.Write(append(data, '\n')); err != nil {
+		panic(err)
+	}
+	closeResponse()
+}
+
+// streamResponses writes every response into JSON array as soon as it and its predecessors are ready
+// and then events emitted by direct methods.
+func (provider *DirectServiceProvider) streamResponses(w http.ResponseWriter, respChannels []chan *response, events *eventQueue) {
+	flusher, canFlush := w.(http.Flusher)
+	mustWrite := func(data []byte) {
+		if _, err := w.Write(data); err != nil {
+			panic(err)
+		}
+	}
+
+	mustWrite([]byte{'['})
+	for i, respChannel := range respChannels {
+		data, err := provider.codec.Marshal((<-respChannel).encodable())
+		if err != nil {
+			panic(err)
+		}
+		if i > 0 {
+			mustWrite([]byte{','})
+		}
+		mustWrite(data)
+		if canFlush {
+			flusher.Flush()
+		}
+	}
+	for i, ev := range events.encodables() {
+		data, err := provider.codec.Marshal(ev)
+		if err != nil {
+			panic(err)
+		}
+		if i > 0 || len(respChannels) > 0 {
+			mustWrite([]byte{','})
+		}
+		mustWrite(data)
+	}
+	mustWrite([]byte("]\n"))
 }
 
 func (provider *DirectServiceProvider) processRequests(c context.Context, r *http.Request, reqs []*request) []*response {
 	resps := make([]*response, len(reqs))
-	respsChannel := make(chan *response, len(reqs))
-	for _, req := range reqs {
-		go func(req *request) {
-			resp := &response{
-				Tid: req.Tid,
-				Action: req.Action,
-				Method: req.Method,
-				Type: req.Type,
+	for i, respChannel := range provider.startRequests(c, r, reqs) {
+		resps[i] = <-respChannel
+	}
+
+	return resps
+}
+
+// startRequests concurrently (or sequentially for transactional batch) processes requests and returns channels
+// delivering responses in order of requests.
+func (provider *DirectServiceProvider) startRequests(c context.Context, r *http.Request, reqs []*request) []chan *response {
+	if provider.metrics != nil {
+		provider.metrics.BatchReceived(len(reqs))
+	}
+	var batchSpan Span
+	pendingReqs := int32(len(reqs))
+	if provider.tracer != nil {
+		c, batchSpan = provider.tracer.StartBatch(contextOrBackground(c), r, len(reqs))
+		if len(reqs) == 0 {
+			batchSpan.End(nil)
+		}
+	}
+	respChannels := make([]chan *response, len(reqs))
+	for i := range reqs {
+		respChannels[i] = make(chan *response, 1)
+	}
+	if provider.unitOfWork != nil && len(reqs) > 0 {
+		go func() {
+			resps := provider.processUnitOfWork(c, r, reqs)
+			if batchSpan != nil {
+				batchSpan.End(nil)
 			}
-			var tStart time.Time
-			profilingStarted := false
-
-			logProfiling := func() {
-				if profilingStarted {
-					duration := time.Now().Sub(tStart)
-					log.Print(logLevelInfo, fmt.Sprintf("%s.%s() %v ", req.Action, req.Method, duration), map[string]interface{}{"duration":duration, "action": req.Action, "method": req.Method})
-					profilingStarted = false
-				}
+			for i, resp := range resps {
+				respChannels[i] <- resp
 			}
+		}()
+		return respChannels
+	}
+	for i, req := range reqs {
+		go func(req *request, respChannel chan *response) {
+			resp := provider.processRequest(c, r, req)
+			// Batch span is ended by the last processed request before its response is delivered.
+			if batchSpan != nil && atomic.AddInt32(&pendingReqs, -1) == 0 {
+				batchSpan.End(nil)
+			}
+			respChannel <- resp
+		}(req, respChannels[i])
+	}
+
+	return respChannels
+}
+
+func (provider *DirectServiceProvider) processRequest(c context.Context, r *http.Request, req *request) (resp *response) {
+	resp = &response{
+		Tid: req.Tid,
+		Action: req.Action,
+		Method: req.Method,
+		Type: req.Type,
+	}
+	var tStart time.Time
+	profilingStarted := false
+	isPanic := false
+	var callErr error
+
+	if provider.tracer != nil {
+		var callSpan Span
+		c, callSpan = provider.tracer.StartCall(contextOrBackground(c), req.Action, req.Method, req.Tid)
+		defer func() {
+			callSpan.End(callErr)
+		}()
+	}
+
+	hasMetadata := len(req.Metadata) > 0 && string(req.Metadata) != "null"
+	if hasMetadata {
+		c = withMetadata(c, req.Metadata, provider.codec)
+	}
 
+	var args []reflect.Value
+	tCallStart := time.Now()
+	callStatus := func() CallStatus {
+		if isPanic {
+			return CallPanic
+		} else if resp.Type == "exception" {
+			return CallError
+		}
+		return CallSuccess
+	}
+
+	if provider.auditor != nil {
+		defer func() {
+			provider.auditor.Audit(&AuditRecord{
+				User: provider.user(c, r),
+				Action: req.Action,
+				Method: req.Method,
+				Tid: req.Tid,
+				Args: redactArgs(args, provider.actionsInfo[req.Action].DirectMethods[req.Method].redact),
+				Status: callStatus(),
+				Err: callErr,
+				Duration: time.Now().Sub(tCallStart),
+			})
+		}()
+	}
+
+	if provider.metrics != nil {
+		if _, ok := provider.actionsInfo[req.Action].Methods[req.Method]; ok {
+			provider.metrics.CallStarted(req.Action, req.Method)
 			defer func() {
-				logProfiling()
-				if err := recover(); err != nil {
-					log.Print(fail.New(ErrDirectActionMethod{req.Action, req.Method, err, true}))
-					resp.Type = "exception"
-					respMessage := fmt.Sprintf("%v", err)
-					resp.Message = &respMessage
-				}
-				respsChannel <- resp
+				provider.metrics.CallFinished(req.Action, req.Method, time.Now().Sub(tCallStart), callStatus())
 			}()
+		}
+	}
 
-			// Create instance of action type
-			actionInfo := provider.actionsInfo[req.Action]
+	logProfiling := func() {
+		if profilingStarted {
+			duration := time.Now().Sub(tStart)
+			provider.log().Info(fmt.Sprintf("%s.%s() %v", req.Action, req.Method, duration), "duration", duration, "action", req.Action, "method", req.Method)
+			profilingStarted = false
+		}
+	}
+
+	// Replay result of call with the same idempotency key. Result is stored by deferred call which runs
+	// after recovering from panic, so exception of panicked call is not stored.
+	inUnitOfWork := CurrentUnitOfWork(c) != nil
+	if idempotencyKey := provider.idempotencyKey(c, r, req); idempotencyKey != "" && !inUnitOfWork {
+		idempotency := provider.idempotency
+		if result, ok := idempotency.begin(idempotencyKey); ok {
 			if provider.debug {
-				log.Print(fmt.Sprintf("Create instance of action %s (type %v)", req.Action, actionInfo.Type))
+				provider.log().Debug(fmt.Sprintf("Replay result of %s.%s", req.Action, req.Method))
 			}
-			actionVal := reflect.New(actionInfo.Type).Elem()
-
-			// Set context and request
-			if c != nil || r != nil {
-				if provider.debug {
-					log.Print("Set action context/request.")
-				}
-				contextType := reflect.TypeOf((*context.Context)(nil)).Elem()
-				requestType := reflect.TypeOf(&http.Request{})
-				fieldsLen := actionInfo.Type.NumField()
-				for i := 0; i < fieldsLen; i++ {
-					t := actionInfo.Type.Field(i).Type
-
-					if t.Implements(contextType) {
-						if c != nil {
-							if provider.debug {
-								log.Print("Set action context.")
-							}
-							actionVal.Field(i).Set(reflect.ValueOf(c))
-						} else {
-							if provider.debug {
-								log.Print(logLevelWarn, "Context cannot be set to action instance because context is nil.")
-							}
-						}
-					}
+			resp.Result = result
+			return
+		}
+		defer idempotency.end(idempotencyKey, resp)
+	}
 
-					if t == requestType {
-						if r != nil {
-							if provider.debug {
-								log.Print("Set action request.")
-							}
-							actionVal.Field(i).Set(reflect.ValueOf(r))
-						}
-					}
-				}
-			}
+	// Rate limit is checked before joining identical call, so joined calls are limited per client too.
+	if limited := provider.rateLimited(c, r, req.Action, req.Method); limited != nil {
+		callErr = *limited
+		provider.log().Warn(limited.Error(), "action", req.Action, "method", req.Method, "error", callErr)
+		resp.Type = "exception"
+		respMessage := limited.Error()
+		resp.Message = &respMessage
+		resp.RetryAfter = int(math.Ceil(limited.RetryAfter.Seconds()))
+		return
+	}
 
+	// Join identical call in progress or lead new one. Like idempotency, response is delivered after recovering.
+	if coalesceKey := provider.coalesceKey(c, r, req); coalesceKey != "" && !inUnitOfWork {
+		call, leader := provider.coalescer.join(coalesceKey)
+		if !leader {
 			if provider.debug {
-				log.Print(fmt.Sprintf("Prepare arguments for method %s.%s", req.Action, req.Method))
-			}
-			methodInfo := actionInfo.Methods[req.Method]
-			directMethod := actionInfo.DirectMethods[req.Method]
-			isFormHandler := false
-			if directMethod.FormHandler != nil {
-				isFormHandler = *directMethod.FormHandler
-			}
-			if provider.debug {
-				log.Print(fmt.Sprintf("Direct method to use: %s, formhandler=%v", directMethod.Name, isFormHandler))
+				provider.log().Debug(fmt.Sprintf("Wait for identical call of %s.%s", req.Action, req.Method))
 			}
-			methodArgsLen := methodInfo.Type.NumIn() - 1
-			var args []reflect.Value
-			if (req.Data != nil && !isFormHandler) || (req.FormData != nil && isFormHandler) {
-				if isFormHandler {
+			<-call.done
+			resp.Type = call.resp.Type
+			resp.Message = call.resp.Message
+			resp.Result = call.resp.Result
+			resp.RetryAfter = call.resp.RetryAfter
+			return
+		}
+		defer provider.coalescer.finish(coalesceKey, call, resp)
+	}
+
+	defer func() {
+		logProfiling()
+		if err := recover(); err != nil {
+			isPanic = true
+			methodErr := fail.New(ErrDirectActionMethod{req.Action, req.Method, err, true})
+			callErr = methodErr
+			provider.log().Error(methodErr.Error(), "action", req.Action, "method", req.Method, "error", methodErr)
+			resp.Type = "exception"
+			respMessage := fmt.Sprintf("%v", err)
+			resp.Message = &respMessage
+		}
+	}()
+
+	// Create instance of action type
+	actionInfo := provider.actionsInfo[req.Action]
+	if _, ok := actionInfo.Methods[req.Method]; !ok {
+		panic(ErrUnknownMethod{req.Action, req.Method})
+	}
+	if provider.debug {
+		provider.log().Debug(fmt.Sprintf("Create instance of action %s (type %v)", req.Action, actionInfo.Type))
+	}
+	actionVal := reflect.New(actionInfo.Type).Elem()
+
+	// Set context and request
+	if c != nil || r != nil {
+		if provider.debug {
+			provider.log().Debug("Set action context/request.")
+		}
+		contextType := reflect.TypeOf((*context.Context)(nil)).Elem()
+		requestType := reflect.TypeOf(&http.Request{})
+		fieldsLen := actionInfo.Type.NumField()
+		for i := 0; i < fieldsLen; i++ {
+			t := actionInfo.Type.Field(i).Type
+
+			if t.Implements(contextType) {
+				if c != nil {
 					if provider.debug {
-						log.Print("Prepare arguments for form handler call.")
+						provider.log().Debug("Set action context.")
 					}
-					args = make([]reflect.Value, 1)
-					args[0] = reflect.ValueOf(req.FormData)
-					// TODO: Support structure type argument for form handler.
+					actionVal.Field(i).Set(reflect.ValueOf(c))
 				} else {
-					args = make([]reflect.Value, methodArgsLen)
-					var argsArray []json.RawMessage
-					if err := json.Unmarshal(req.Data, &argsArray); err != nil {
-						panic(fail.NewErrWithReason("could not parse request data", err))
-					}
-					for i, arg := range argsArray {
-						methodArgType := methodInfo.Type.In(i + 1)
-						if provider.debug {
-							log.Print(fmt.Sprintf("Parse `%v` into %v", string(arg), methodArgType))
-						}
-						argValue := reflect.New(methodArgType).Elem()
-						argRef := argValue.Addr().Interface()
-						json.Unmarshal(arg, argRef)
-						args[i] = reflect.ValueOf(argValue.Interface())
+					if provider.debug {
+						provider.log().Warn("Context cannot be set to action instance because context is nil.")
 					}
 				}
 			}
 
-			if provider.profile {
-				profilingStarted = true
-				tStart = time.Now()
+			if t == requestType {
+				if r != nil {
+					if provider.debug {
+						provider.log().Debug("Set action request.")
+					}
+					actionVal.Field(i).Set(reflect.ValueOf(r))
+				}
 			}
+		}
+	}
+
+	// Set event publisher and cache invalidator
+	for i := 0; i < actionInfo.Type.NumField(); i++ {
+		if t := actionInfo.Type.Field(i).Type; t == publisherType || t == cacheInvalidatorType {
+			actionVal.Field(i).Set(reflect.ValueOf(provider))
+		}
+	}
 
+	if provider.debug {
+		provider.log().Debug(fmt.Sprintf("Prepare arguments for method %s.%s", req.Action, req.Method))
+	}
+	methodInfo := actionInfo.Methods[req.Method]
+	directMethod := actionInfo.DirectMethods[req.Method]
+	isFormHandler := false
+	if directMethod.FormHandler != nil {
+		isFormHandler = *directMethod.FormHandler
+	}
+	if provider.debug {
+		provider.log().Debug(fmt.Sprintf("Direct method to use: %s, formhandler=%v", directMethod.Name, isFormHandler))
+	}
+	methodArgsLen := methodInfo.Type.NumIn() - 1
+	if (req.Data != nil && !isFormHandler) || (req.FormData != nil && isFormHandler) {
+		if isFormHandler {
 			if provider.debug {
-				log.Print(fmt.Sprintf("Call method %s.%s", req.Action, req.Method))
+				provider.log().Debug("Prepare arguments for form handler call.")
 			}
-			// Call action method.
-			resultsValues := actionVal.MethodByName(methodInfo.Name).Call(args)
-
-			logProfiling()
-			for i, resultValue := range resultsValues {
-				if methodInfo.Type.Out(i).Name() == "error" {
-					if err, isErr := resultValue.Interface().(error); isErr {
-						log.Print(&ErrDirectActionMethod{req.Action, req.Method, err, false})
-						resp.Type = "exception"
-						respMessage := fmt.Sprintf("%v", err)
-						resp.Message = &respMessage
-						resp.Result = nil
-						break;
+			args = make([]reflect.Value, 1)
+			args[0] = reflect.ValueOf(req.FormData)
+			// TODO: Support structure type argument for form handler.
+		} else {
+			args = make([]reflect.Value, methodArgsLen)
+			var argsArray []json.RawMessage
+			if err := provider.codec.Unmarshal(req.Data, &argsArray); err != nil {
+				panic(fail.NewErrWithReason("could not parse request data", err))
+			}
+			for i, arg := range argsArray {
+				methodArgType := methodInfo.Type.In(i + 1)
+				if provider.debug {
+					provider.log().Debug(fmt.Sprintf("Parse `%v` into %v", string(arg), methodArgType))
+				}
+				argValue := reflect.New(methodArgType).Elem()
+				argRef := argValue.Addr().Interface()
+				provider.codec.Unmarshal(arg, argRef)
+				args[i] = reflect.ValueOf(argValue.Interface())
+			}
+			if directMethod.metadataParam {
+				metadataType := methodInfo.Type.In(methodArgsLen)
+				metadataValue := reflect.New(metadataType).Elem()
+				if hasMetadata {
+					if err := provider.codec.Unmarshal(req.Metadata, metadataValue.Addr().Interface()); err != nil {
+						panic(fail.NewErrWithReason("could not parse request metadata", err))
 					}
-				} else {
-					result := resultValue.Interface()
-					resp.Result = result
 				}
+				args[methodArgsLen - 1] = metadataValue
+			}
+		}
+	}
+
+	cacheKey := ""
+	if directMethod.cacheTTL > 0 && provider.cache != nil && !inUnitOfWork {
+		argValues := make([]interface{}, len(args))
+		for i, arg := range args {
+			argValues[i] = arg.Interface()
+		}
+		cacheKey = provider.cacheKey(c, r, req.Action, req.Method, argValues, directMethod.cachePerUser)
+		if cacheKey != "" {
+			if result, ok := provider.cache.Get(cacheKey); ok {
+				if provider.debug {
+					provider.log().Debug(fmt.Sprintf("Use cached result of %s.%s", req.Action, req.Method))
+				}
+				resp.Result = result
+				return
 			}
-		}(req)
+		}
 	}
 
-	for i := 0; i < len(reqs); i++ {
-		var resp = <-respsChannel
-		resps[i] = resp
+	if provider.profile {
+		profilingStarted = true
+		tStart = time.Now()
 	}
 
-	return resps
+	if provider.debug {
+		provider.log().Debug(fmt.Sprintf("Call method %s.%s", req.Action, req.Method))
+	}
+	// Call action method.
+	resultsValues := actionVal.MethodByName(methodInfo.Name).Call(args)
+
+	logProfiling()
+	for i, resultValue := range resultsValues {
+		if methodInfo.Type.Out(i).Name() == "error" {
+			if err, isErr := resultValue.Interface().(error); isErr {
+				methodErr := ErrDirectActionMethod{req.Action, req.Method, err, false}
+				callErr = methodErr
+				provider.log().Error(methodErr.Error(), "action", req.Action, "method", req.Method, "error", methodErr)
+				resp.Type = "exception"
+				respMessage := fmt.Sprintf("%v", err)
+				resp.Message = &respMessage
+				resp.Result = nil
+				break;
+			}
+		} else {
+			if provider.emptyCollections {
+				resultValue = emptyCollection(resultValue)
+			}
+			result := resultValue.Interface()
+			resp.Result = result
+		}
+	}
+	if cacheKey != "" && resp.Type != "exception" {
+		provider.cache.Set(cacheKey, resp.Result, directMethod.cacheTTL)
+	}
+	return
+}
+
+func emptyCollection(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if !v.IsNil() {
+			return emptyCollection(v.Elem())
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.MakeSlice(v.Type(), 0, 0)
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.MakeMap(v.Type())
+		}
+	}
+	return v
 }
 
 func mustDecodeFormPost(f url.Values) []*request {
@@ -296,6 +670,10 @@ func mustDecodeFormPost(f url.Values) []*request {
 
 	data := make(map[string]string, 0)
 	for k, v := range f {
+		if k == "extMetadata" {
+			req.Metadata = json.RawMessage(v[0])
+			continue
+		}
 		if k == "extType" || k == "extTID" || k == "extAction" || k == "extMethod" || k == "extUpload" {
 			continue
 		}
@@ -306,15 +684,15 @@ func mustDecodeFormPost(f url.Values) []*request {
 	return []*request{req}
 }
 
-func mustDecodeTransaction(r io.Reader) []*request {
+func (provider *DirectServiceProvider) mustDecodeTransaction(r io.Reader) []*request {
 	if jsonData, err := ioutil.ReadAll(r); err != nil {
 		panic(err)
 	} else {
 		var reqs []*request
-		if err := json.Unmarshal(jsonData, &reqs); err != nil {
+		if err := provider.codec.Unmarshal(jsonData, &reqs); err != nil {
 			// Attempt to unmarshal as a single request.
 			var req request
-			if err := json.Unmarshal(jsonData, &req); err != nil {
+			if err := provider.codec.Unmarshal(jsonData, &req); err != nil {
 				panic(err)
 			} else {
 				reqs = make([]*request, 1)
@@ -0,0 +1,272 @@
+package extdirect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Publisher publishes Ext Direct events to Server-Sent Events subscribers of channel.
+// Action field of type Publisher is set to provider before direct method call.
+type Publisher interface {
+	Publish(channel, name string, data interface{}) error
+}
+
+var publisherType = reflect.TypeOf((*Publisher)(nil)).Elem()
+
+// ChannelAuthFunc reports whether client of request may receive events of channel, i.e. Server-Sent Events channel
+// or WebSocket topic. It is called for every published event of subscribers of all channels, so it must be fast
+// and must not publish events.
+type ChannelAuthFunc func(c context.Context, r *http.Request, channel string) bool
+
+const (
+	defaultEventStreamHeartbeat = 15 * time.Second
+	defaultEventStreamBuffer    = 100
+	// eventStreamSubscriberBuffer is a number of events queued for slow subscriber before it is disconnected
+	// to resume with Last-Event-ID.
+	eventStreamSubscriberBuffer = 64
+)
+
+type streamEvent struct {
+	id      int64
+	channel string
+	data    []byte
+}
+
+type eventStreamSubscriber struct {
+	channels map[string]bool
+	// authorized reports whether subscriber of all channels may receive events of channel; nil authorizes all.
+	authorized func(channel string) bool
+	events     chan *streamEvent
+}
+
+// accepts reports whether subscriber receives events of channel: subscriber without channels receives events
+// of all authorized channels.
+func (sub *eventStreamSubscriber) accepts(channel string) bool {
+	if len(sub.channels) > 0 {
+		return sub.channels[channel]
+	}
+	return sub.authorized == nil || sub.authorized(channel)
+}
+
+// eventStreamBroker dispatches published events to subscribers and keeps recent ones for resuming.
+type eventStreamBroker struct {
+	url        string
+	heartbeat  time.Duration
+	bufferSize int
+	mutex      sync.Mutex
+	lastID     int64
+	buffer     []*streamEvent
+	subs       map[*eventStreamSubscriber]bool
+}
+
+func newEventStreamBroker() *eventStreamBroker {
+	return &eventStreamBroker{
+		heartbeat: defaultEventStreamHeartbeat,
+		bufferSize: defaultEventStreamBuffer,
+		subs: make(map[*eventStreamSubscriber]bool),
+	}
+}
+
+// SetEventStreamURL sets URL of Server-Sent Events endpoint advertised in JavaScript() as <Namespace>.EVENTSOURCE_API
+// along with <Namespace>.EventSourceProvider class and mounted by Mount(). Empty URL disables advertising.
+func (provider *DirectServiceProvider) SetEventStreamURL(url string) {
+	provider.eventStream.url = url
+}
+
+// SetChannelAuthFunc sets function authorizing subscriptions to Server-Sent Events channels and WebSocket topics.
+// Stream requesting unauthorized channel is rejected with 403 Forbidden and stream of all channels receives events
+// of authorized ones only. WebSocket subscription to unauthorized topic is ignored. Nil authorizes all channels.
+func (provider *DirectServiceProvider) SetChannelAuthFunc(channelAuthFunc ChannelAuthFunc) {
+	provider.channelAuthFunc = channelAuthFunc
+}
+
+func (provider *DirectServiceProvider) channelAuthorized(c context.Context, r *http.Request, channel string) bool {
+	return provider.channelAuthFunc == nil || provider.channelAuthFunc(c, r, channel)
+}
+
+// SetEventStreamHeartbeat sets interval of heartbeat comments keeping idle event streams open (15 seconds by default).
+// Zero or negative interval disables heartbeats.
+func (provider *DirectServiceProvider) SetEventStreamHeartbeat(heartbeat time.Duration) {
+	provider.eventStream.heartbeat = heartbeat
+}
+
+// SetEventStreamBuffer sets number of recent events kept to resume event streams by Last-Event-ID (100 by default).
+func (provider *DirectServiceProvider) SetEventStreamBuffer(size int) {
+	provider.eventStream.mutex.Lock()
+	defer provider.eventStream.mutex.Unlock()
+	provider.eventStream.bufferSize = size
+	if len(provider.eventStream.buffer) > size {
+		provider.eventStream.buffer = provider.eventStream.buffer[len(provider.eventStream.buffer) - size:]
+	}
+}
+
+// Publish sends event to Server-Sent Events subscribers of channel.
+func (provider *DirectServiceProvider) Publish(channel, name string, data interface{}) error {
+	message, err := provider.codec.Marshal(&event{"event", name, data})
+	if err != nil {
+		return err
+	}
+	provider.eventStream.publish(channel, message)
+	return nil
+}
+
+func (broker *eventStreamBroker) publish(channel string, data []byte) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	broker.lastID++
+	ev := &streamEvent{broker.lastID, channel, data}
+	if broker.bufferSize > 0 {
+		if len(broker.buffer) >= broker.bufferSize {
+			broker.buffer = append(broker.buffer[:0], broker.buffer[len(broker.buffer) - broker.bufferSize + 1:]...)
+		}
+		broker.buffer = append(broker.buffer, ev)
+	}
+	for sub := range broker.subs {
+		if !sub.accepts(channel) {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+			// Subscriber is too slow: disconnect it so it resumes from buffer.
+			delete(broker.subs, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// subscribe registers subscriber of channels and returns buffered events published after lastID if resume is set.
+// Subscriber of all channels receives events of channels accepted by authorized if it is not nil.
+func (broker *eventStreamBroker) subscribe(channels []string, authorized func(channel string) bool, lastID int64, resume bool) (*eventStreamSubscriber, []*streamEvent) {
+	sub := &eventStreamSubscriber{make(map[string]bool, len(channels)), authorized, make(chan *streamEvent, eventStreamSubscriberBuffer)}
+	for _, channel := range channels {
+		sub.channels[channel] = true
+	}
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	broker.subs[sub] = true
+	var replay []*streamEvent
+	if resume {
+		for _, ev := range broker.buffer {
+			if ev.id > lastID && sub.accepts(ev.channel) {
+				replay = append(replay, ev)
+			}
+		}
+	}
+	return sub, replay
+}
+
+func (broker *eventStreamBroker) unsubscribe(sub *eventStreamSubscriber) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	if broker.subs[sub] {
+		delete(broker.subs, sub)
+		close(sub.events)
+	}
+}
+
+// EventStreamHandler returns handler of Server-Sent Events endpoint streaming events published to channels
+// given by channel query parameters (all channels if there are none) authorized by ChannelAuthFunc of provider
+// (see SetChannelAuthFunc). Stream resumed with Last-Event-ID header
+// (or lastEventId query parameter) starts with missed events still kept in buffer.
+func (provider *DirectServiceProvider) EventStreamHandler() http.Handler {
+	return http.HandlerFunc(provider.serveEventStream)
+}
+
+func (provider *DirectServiceProvider) serveEventStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	lastID, err := strconv.ParseInt(lastEventID, 10, 64)
+	channels := r.URL.Query()["channel"]
+	for _, channel := range channels {
+		if !provider.channelAuthorized(r.Context(), r, channel) {
+			http.Error(w, fmt.Sprintf("channel %s is forbidden", channel), http.StatusForbidden)
+			return
+		}
+	}
+	var authorized func(channel string) bool
+	if provider.channelAuthFunc != nil {
+		authorized = func(channel string) bool {
+			return provider.channelAuthFunc(r.Context(), r, channel)
+		}
+	}
+	broker := provider.eventStream
+	sub, replay := broker.subscribe(channels, authorized, lastID, err == nil)
+	defer broker.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	for _, ev := range replay {
+		if !writeStreamEvent(w, ev) {
+			return
+		}
+	}
+	flusher.Flush()
+
+	var heartbeat <-chan time.Time
+	if broker.heartbeat > 0 {
+		ticker := time.NewTicker(broker.heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-sub.events:
+			if !ok || !writeStreamEvent(w, ev) {
+				return
+			}
+		case <-heartbeat:
+			if _, err := w.Write([]byte(": heartbeat\n\n")); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeStreamEvent(w http.ResponseWriter, ev *streamEvent) bool {
+	_, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", ev.id, ev.data)
+	return err == nil
+}
+
+// eventSourceProviderScript is a definition of Ext.direct provider firing events received from Server-Sent Events
+// endpoint. %[1]s is a namespace.
+const eventSourceProviderScript = `Ext.define("%[1]s.EventSourceProvider",{extend:"Ext.direct.JsonProvider",alias:"direct.eventsourceprovider",` +
+	`isConnected:function(){return !!this.source;},` +
+	`connect:function(){var me=this,url=me.url,ch=[].concat(me.channels||[]);if(me.source||!window.EventSource){return;}` +
+	`if(ch.length){url+=(url.indexOf("?")<0?"?":"&")+Ext.Object.toQueryString({channel:ch});}` +
+	`me.source=new EventSource(url);` +
+	`me.source.onmessage=function(e){Ext.Array.each(me.createEvents({responseText:e.data}),function(ev){me.fireEvent("data",me,ev);});};` +
+	`me.fireEvent("connect",me);},` +
+	`disconnect:function(){if(this.source){this.source.close();this.source=null;this.fireEvent("disconnect",this);}}})`
+
+// eventSourceJavaScript returns definition of Server-Sent Events provider class and its config or empty string if
+// event stream URL is not set.
+func (provider DirectServiceProvider) eventSourceJavaScript() (string, error) {
+	if provider.eventStream.url == "" {
+		return "", nil
+	}
+	urlJSON, err := json.Marshal(provider.eventStream.url)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(eventSourceProviderScript + `;%[1]s.EVENTSOURCE_API={type:"eventsourceprovider",url:%[2]s}`,
+		provider.Namespace, string(urlJSON)), nil
+}
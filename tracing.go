@@ -0,0 +1,33 @@
+package extdirect
+
+import (
+	"context"
+	"net/http"
+)
+
+// Tracer opens spans for transactions and their direct method calls.
+type Tracer interface {
+	// StartBatch starts span of transaction with size calls. Request may be nil if calls are processed outside of HTTP handler.
+	// Returned context is a parent for calls of transaction.
+	StartBatch(c context.Context, r *http.Request, size int) (context.Context, Span)
+	// StartCall starts span of direct method call. Returned context is set to action instance.
+	StartCall(c context.Context, action, method string, tid int) (context.Context, Span)
+}
+
+// Span is a traced operation.
+type Span interface {
+	// End ends span with error occurred during operation or nil.
+	End(err error)
+}
+
+// SetTracer sets tracer of provider.
+func (provider *DirectServiceProvider) SetTracer(tracer Tracer) {
+	provider.tracer = tracer
+}
+
+func contextOrBackground(c context.Context) context.Context {
+	if c == nil {
+		return context.Background()
+	}
+	return c
+}
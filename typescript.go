@@ -0,0 +1,204 @@
+package extdirect
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TypeScript returns TypeScript declarations of provider namespace: interfaces of struct arguments and results
+// (with fields named by JSON tags) and functions of every registered action method.
+// Declarations can be produced by go generate with program registering actions and writing them with WriteTypeScript().
+func (provider *DirectServiceProvider) TypeScript() string {
+	g := &tsGenerator{names: make(map[reflect.Type]string), interfaces: make(map[string]string)}
+	actions := &bytes.Buffer{}
+
+	actionNames := make([]string, 0, len(provider.Actions))
+	for actionName := range provider.Actions {
+		actionNames = append(actionNames, actionName)
+	}
+	sort.Strings(actionNames)
+
+	for _, actionName := range actionNames {
+		actionInfo := provider.actionsInfo[actionName]
+		fmt.Fprintf(actions, "    namespace %s {\n", actionName)
+		for _, directMethod := range provider.Actions[actionName] {
+			methodType := actionInfo.Methods[directMethod.Name].Type
+			var params []string
+			if directMethod.FormHandler != nil && *directMethod.FormHandler {
+				params = append(params, "form: any")
+			} else {
+				for i := 1; i <= *directMethod.Len; i++ {
+					params = append(params, fmt.Sprintf("arg%d: %s", i - 1, g.typeOf(methodType.In(i))))
+				}
+			}
+			params = append(params, fmt.Sprintf("callback?: (result: %s, event: any) => void", g.resultTypeOf(methodType)), "scope?: any")
+			fmt.Fprintf(actions, "        function %s(%s): void;\n", directMethod.Name, strings.Join(params, ", "))
+		}
+		actions.WriteString("    }\n")
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "declare namespace %s {\n", provider.Namespace)
+	interfaceNames := make([]string, 0, len(g.interfaces))
+	for name := range g.interfaces {
+		interfaceNames = append(interfaceNames, name)
+	}
+	sort.Strings(interfaceNames)
+	for _, name := range interfaceNames {
+		fmt.Fprintf(buf, "    interface %s {\n%s    }\n", name, g.interfaces[name])
+	}
+	buf.Write(actions.Bytes())
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// WriteTypeScript writes TypeScript declarations of provider into file.
+func (provider *DirectServiceProvider) WriteTypeScript(filename string) error {
+	return ioutil.WriteFile(filename, []byte(provider.TypeScript()), 0644)
+}
+
+type tsGenerator struct {
+	names      map[reflect.Type]string
+	interfaces map[string]string
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	tsIdentifierRegexp = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+)
+
+// resultTypeOf returns type of direct method result which is its last non-error output.
+func (g *tsGenerator) resultTypeOf(methodType reflect.Type) string {
+	result := "null"
+	for i := 0; i < methodType.NumOut(); i++ {
+		if t := methodType.Out(i); t != errorType {
+			result = g.typeOf(t)
+		}
+	}
+	return result
+}
+
+func (g *tsGenerator) typeOf(t reflect.Type) string {
+	if t == timeType {
+		return "string"
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) {
+		return "any"
+	}
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Ptr:
+		return g.typeOf(t.Elem())
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+		elemType := g.typeOf(t.Elem())
+		if strings.ContainsAny(elemType, " |") {
+			elemType = "(" + elemType + ")"
+		}
+		return elemType + "[]"
+	case reflect.Map:
+		return fmt.Sprintf("{ [key: string]: %s }", g.typeOf(t.Elem()))
+	case reflect.Struct:
+		if t.Name() == "" {
+			return "{ " + strings.Replace(strings.TrimSpace(g.fieldsOf(t, "")), "\n", " ", -1) + " }"
+		}
+		return g.interfaceOf(t)
+	}
+	return "any"
+}
+
+func (g *tsGenerator) interfaceOf(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, ok := g.interfaces[name]; ok {
+		pkgPath := strings.Split(t.PkgPath(), "/")
+		pkgName := pkgPath[len(pkgPath) - 1]
+		name = strings.ToUpper(pkgName[:1]) + pkgName[1:] + name
+	}
+	g.names[t] = name
+	g.interfaces[name] = ""
+	g.interfaces[name] = g.fieldsOf(t, "        ")
+	return name
+}
+
+func (g *tsGenerator) fieldsOf(t reflect.Type, indent string) string {
+	buf := &bytes.Buffer{}
+	for _, f := range jsonFields(t) {
+		name := f.Name
+		if !tsIdentifierRegexp.MatchString(name) {
+			name = fmt.Sprintf("%q", name)
+		}
+		optional := ""
+		if f.OmitEmpty {
+			optional = "?"
+		}
+		fmt.Fprintf(buf, "%s%s%s: %s;\n", indent, name, optional, g.typeOf(f.Type))
+	}
+	return buf.String()
+}
+
+type jsonField struct {
+	reflect.StructField
+	OmitEmpty bool
+}
+
+// jsonFields returns fields of struct encoded by encoding/json with names set from JSON tags.
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		f := jsonField{StructField: t.Field(i)}
+		jsonTag := strings.Split(f.Tag.Get("json"), ",")
+		if jsonTag[0] == "-" {
+			continue
+		}
+		// Fields of embedded structs are promoted even if struct type is unexported.
+		if f.Anonymous && jsonTag[0] == "" {
+			embeddedType := f.Type
+			if embeddedType.Kind() == reflect.Ptr {
+				embeddedType = embeddedType.Elem()
+			}
+			if embeddedType.Kind() == reflect.Struct {
+				for _, embeddedField := range jsonFields(embeddedType) {
+					embeddedField.Index = append([]int{i}, embeddedField.Index...)
+					fields = append(fields, embeddedField)
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if jsonTag[0] != "" {
+			f.Name = jsonTag[0]
+		}
+		for _, option := range jsonTag[1:] {
+			if option == "omitempty" {
+				f.OmitEmpty = true
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
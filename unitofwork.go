@@ -0,0 +1,102 @@
+package extdirect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// UnitOfWork is shared by all calls of transactional batch, e.g. database transaction.
+type UnitOfWork interface {
+	// Commit is called after all calls of batch succeeded.
+	Commit() error
+	// Rollback is called after call of batch resulted in exception with error of that call.
+	Rollback(err error)
+}
+
+// UnitOfWorkFunc begins unit of work of transactional batch. Request is nil for batches called in process.
+type UnitOfWorkFunc func(c context.Context, r *http.Request) (UnitOfWork, error)
+
+// ErrRolledBack is an exception of calls of transactional batch rolled back because of exception of another call.
+type ErrRolledBack struct {
+	Action string
+	Method string
+}
+
+func (err ErrRolledBack) Error() string {
+	return fmt.Sprintf("batch rolled back after exception in %v.%v()", err.Action, err.Method)
+}
+
+// ErrUnitOfWork is an exception of calls of transactional batch which unit of work could not begin or commit.
+type ErrUnitOfWork struct {
+	Op  string
+	Err interface{}
+}
+
+func (err ErrUnitOfWork) Error() string {
+	return fmt.Sprintf("could not %v unit of work: %v", err.Op, err.Err)
+}
+
+type unitOfWorkKey struct{}
+
+// SetUnitOfWork enables transactional batches: all calls of batch are executed sequentially sharing unit of work
+// begun by begin (see CurrentUnitOfWork). After exception of any call unit of work is rolled back, remaining calls
+// are not executed and all other calls (including executed ones) get ErrRolledBack exceptions; otherwise unit of work
+// is committed. Responses are delivered once batch is committed or rolled back; events emitted by calls of batch
+// which is not committed are discarded. Calls of transactional batches are neither coalesced, replayed by idempotency
+// key nor cached, since their results are not committed yet. Nil disables transactional batches.
+func (provider *DirectServiceProvider) SetUnitOfWork(begin UnitOfWorkFunc) {
+	provider.unitOfWork = begin
+}
+
+// CurrentUnitOfWork returns unit of work of transactional batch direct method is called in or nil if batch
+// is not transactional. Context must be the one set to action of the method.
+func CurrentUnitOfWork(c context.Context) UnitOfWork {
+	if c == nil {
+		return nil
+	}
+	unitOfWork, _ := c.Value(unitOfWorkKey{}).(UnitOfWork)
+	return unitOfWork
+}
+
+// processUnitOfWork sequentially processes requests of transactional batch sharing unit of work.
+func (provider *DirectServiceProvider) processUnitOfWork(c context.Context, r *http.Request, reqs []*request) (resps []*response) {
+	op := "begin"
+	committed := false
+	defer func() {
+		if err := recover(); err != nil {
+			unitOfWorkErr := ErrUnitOfWork{op, err}
+			provider.log().Error(unitOfWorkErr.Error(), "error", unitOfWorkErr)
+			resps = exceptionResponses(reqs, unitOfWorkErr)
+		}
+		if !committed {
+			discardEvents(c)
+		}
+	}()
+
+	c = contextOrBackground(c)
+	unitOfWork, err := provider.unitOfWork(c, r)
+	if err != nil {
+		return exceptionResponses(reqs, ErrUnitOfWork{op, err})
+	}
+	c = context.WithValue(c, unitOfWorkKey{}, unitOfWork)
+
+	resps = make([]*response, len(reqs))
+	for i, req := range reqs {
+		resps[i] = provider.processRequest(c, r, req)
+		if resps[i].Type != "exception" {
+			continue
+		}
+		op = "roll back"
+		unitOfWork.Rollback(ErrException{req.Action, req.Method, *resps[i].Message})
+		rolledBack := exceptionResponses(reqs, ErrRolledBack{req.Action, req.Method})
+		rolledBack[i] = resps[i]
+		return rolledBack
+	}
+	op = "commit"
+	if err := unitOfWork.Commit(); err != nil {
+		return exceptionResponses(reqs, ErrUnitOfWork{op, err})
+	}
+	committed = true
+	return resps
+}
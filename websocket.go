@@ -0,0 +1,278 @@
+package extdirect
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"golang.org/x/net/websocket"
+)
+
+// event is an Ext Direct event message pushed to clients.
+type event struct {
+	Type string      `json:"type"`
+	Name string      `json:"name"`
+	Data interface{} `json:"data"`
+}
+
+// subscription is a control message of WebSocket client changing topics it receives events of.
+type subscription struct {
+	Type   string   `json:"type"`
+	Topics []string `json:"topics"`
+}
+
+type webSocketConn struct {
+	ws     *websocket.Conn
+	user   string
+	topics map[string]bool
+	// writeMutex serializes writes of responses and pushed events.
+	writeMutex sync.Mutex
+}
+
+// webSocketHub tracks connected WebSocket clients of provider.
+type webSocketHub struct {
+	url            string
+	trustedOrigins []string
+	mutex          sync.RWMutex
+	conns          map[*webSocketConn]bool
+}
+
+// ErrWebSocketOrigin occurs when WebSocket handshake comes from origin other than the host of request
+// and trusted origins.
+type ErrWebSocketOrigin string
+
+func (err ErrWebSocketOrigin) Error() string {
+	return fmt.Sprintf("untrusted WebSocket origin %q", string(err))
+}
+
+// SetWebSocketURL sets URL of WebSocket transport advertised in JavaScript() as <Namespace>.WEBSOCKET_API
+// along with <Namespace>.WebSocketProvider class and mounted by Mount(). Empty URL disables advertising.
+func (provider *DirectServiceProvider) SetWebSocketURL(url string) {
+	provider.webSocket.url = url
+}
+
+// SetWebSocketTrustedOrigins sets origins like "https://app.example.com" allowed to open WebSocket
+// besides the host of request.
+func (provider *DirectServiceProvider) SetWebSocketTrustedOrigins(origins ...string) {
+	provider.webSocket.trustedOrigins = origins
+}
+
+// WebSocketHandler returns handler of WebSocket transport: every text message is a transaction (single
+// request or array of them) processed like POSTed ones, responses of which are sent back as JSON array
+// message. Message {"type":"subscribe","topics":[...]} (or "unsubscribe") changes topics client receives
+// events of; topics not authorized by ChannelAuthFunc of provider are ignored (see SetChannelAuthFunc). Events pushed by Push, PushTopic and PushUser are sent as {"type":"event","name":...,"data":...}.
+// Handshake is rejected unless its Origin is the host of request or one of trusted origins (see
+// SetWebSocketTrustedOrigins and CSRF.TrustedOrigins), since browsers send cookies with cross-site ones.
+// Handshake is also verified by CSRF protection of provider if it is set (see CSRF).
+func (provider *DirectServiceProvider) WebSocketHandler() http.Handler {
+	return websocket.Server{Handler: provider.serveWebSocket, Handshake: provider.webSocketHandshake}
+}
+
+func (provider *DirectServiceProvider) webSocketHandshake(config *websocket.Config, r *http.Request) error {
+	trustedOrigins := provider.webSocket.trustedOrigins
+	if provider.csrf != nil {
+		trustedOrigins = append(append([]string{}, trustedOrigins...), provider.csrf.TrustedOrigins...)
+	}
+	origin := r.Header.Get("Origin")
+	var err error
+	if !isTrustedOrigin(r, origin, trustedOrigins) {
+		err = ErrWebSocketOrigin(origin)
+	} else if provider.csrf != nil {
+		err = provider.csrf.verifyWebSocket(r)
+	}
+	if err != nil {
+		provider.log().Warn(err.Error(), "error", err)
+		return err
+	}
+	return nil
+}
+
+// isTrustedOrigin reports whether origin is the host of request or one of trusted origins.
+func isTrustedOrigin(r *http.Request, origin string, trustedOrigins []string) bool {
+	if origin == "" {
+		return false
+	}
+	for _, trusted := range trustedOrigins {
+		if strings.EqualFold(origin, trusted) {
+			return true
+		}
+	}
+	originURL, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(originURL.Host, r.Host)
+}
+
+func (provider *DirectServiceProvider) serveWebSocket(ws *websocket.Conn) {
+	r := ws.Request()
+	c, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	conn := &webSocketConn{ws: ws, user: provider.user(c, r), topics: make(map[string]bool)}
+	provider.webSocket.add(conn)
+	defer func() {
+		provider.webSocket.remove(conn)
+		ws.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		var message []byte
+		if err := websocket.Message.Receive(ws, &message); err != nil {
+			return
+		}
+		var sub subscription
+		if err := provider.codec.Unmarshal(message, &sub); err == nil && (sub.Type == "subscribe" || sub.Type == "unsubscribe") {
+			topics := sub.Topics
+			if sub.Type == "subscribe" {
+				topics = provider.authorizedTopics(c, r, topics)
+			}
+			provider.webSocket.subscribe(conn, topics, sub.Type == "subscribe")
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			provider.processWebSocketMessage(c, r, conn, message)
+		}()
+	}
+}
+
+// authorizedTopics returns topics client of request may subscribe to.
+func (provider *DirectServiceProvider) authorizedTopics(c context.Context, r *http.Request, topics []string) []string {
+	authorized := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		if provider.channelAuthorized(c, r, topic) {
+			authorized = append(authorized, topic)
+		} else {
+			provider.log().Warn(fmt.Sprintf("WebSocket subscription to topic %s is forbidden", topic), "topic", topic)
+		}
+	}
+	return authorized
+}
+
+func (provider *DirectServiceProvider) processWebSocketMessage(c context.Context, r *http.Request, conn *webSocketConn, message []byte) {
+	defer func() {
+		if err := recover(); err != nil {
+			provider.log().Error(fmt.Sprintf("could not process WebSocket message: %v", err), "error", err)
+		}
+	}()
+	reqs := provider.mustDecodeTransaction(bytes.NewReader(message))
+	c, events := withEventQueue(c)
+	resps := provider.processRequests(c, r, reqs)
+	data, err := provider.codec.Marshal(encodables(resps, events))
+	if err != nil {
+		panic(err)
+	}
+	conn.send(data)
+}
+
+func (conn *webSocketConn) send(data []byte) error {
+	conn.writeMutex.Lock()
+	defer conn.writeMutex.Unlock()
+	return websocket.Message.Send(conn.ws, string(data))
+}
+
+func (hub *webSocketHub) add(conn *webSocketConn) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	hub.conns[conn] = true
+}
+
+func (hub *webSocketHub) remove(conn *webSocketConn) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	delete(hub.conns, conn)
+}
+
+func (hub *webSocketHub) subscribe(conn *webSocketConn, topics []string, subscribe bool) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	for _, topic := range topics {
+		if subscribe {
+			conn.topics[topic] = true
+		} else {
+			delete(conn.topics, topic)
+		}
+	}
+}
+
+// broadcast sends data to connections accepted by filter.
+func (hub *webSocketHub) broadcast(data []byte, filter func(conn *webSocketConn) bool) {
+	hub.mutex.RLock()
+	conns := make([]*webSocketConn, 0, len(hub.conns))
+	for conn := range hub.conns {
+		if filter(conn) {
+			conns = append(conns, conn)
+		}
+	}
+	hub.mutex.RUnlock()
+	for _, conn := range conns {
+		if err := conn.send(data); err != nil {
+			conn.ws.Close()
+		}
+	}
+}
+
+func (provider *DirectServiceProvider) pushWebSocket(name string, data interface{}, filter func(conn *webSocketConn) bool) error {
+	message, err := provider.codec.Marshal(&event{"event", name, data})
+	if err != nil {
+		return err
+	}
+	provider.webSocket.broadcast(message, filter)
+	return nil
+}
+
+// Push sends event to all connected WebSocket clients.
+func (provider *DirectServiceProvider) Push(name string, data interface{}) error {
+	return provider.pushWebSocket(name, data, func(conn *webSocketConn) bool {
+		return true
+	})
+}
+
+// PushTopic sends event to WebSocket clients subscribed to topic.
+func (provider *DirectServiceProvider) PushTopic(topic, name string, data interface{}) error {
+	return provider.pushWebSocket(name, data, func(conn *webSocketConn) bool {
+		return conn.topics[topic]
+	})
+}
+
+// PushUser sends event to WebSocket clients of user as identified by UserFunc of provider.
+func (provider *DirectServiceProvider) PushUser(user, name string, data interface{}) error {
+	return provider.pushWebSocket(name, data, func(conn *webSocketConn) bool {
+		return conn.user == user
+	})
+}
+
+// webSocketProviderScript is a definition of Ext.direct provider sending transactions over WebSocket
+// (falling back to HTTP for forms) and firing pushed events. %[1]s is a namespace.
+const webSocketProviderScript = `Ext.define("%[1]s.WebSocketProvider",{extend:"Ext.direct.RemotingProvider",alias:"direct.websocketprovider",` +
+	`connect:function(){this.callParent(arguments);this.openSocket();},` +
+	`openSocket:function(){var me=this,url=me.wsUrl,s;if(me.socket||!window.WebSocket){return;}` +
+	`if(url.charAt(0)==="/"){url=(location.protocol==="https:"?"wss://":"ws://")+location.host+url;}` +
+	`s=me.socket=new WebSocket(url);me.pending=me.pending||[];` +
+	`s.onopen=function(){Ext.Array.each(me.pending,function(m){s.send(m);});me.pending=[];};` +
+	`s.onmessage=function(e){me.onData({transaction:[]},true,{responseText:e.data});};` +
+	`s.onclose=function(){me.socket=null;};},` +
+	`sendMessage:function(m){this.openSocket();if(this.socket&&this.socket.readyState===1){this.socket.send(m);}else{(this.pending=this.pending||[]).push(m);}},` +
+	`subscribe:function(topics){this.sendMessage(Ext.encode({type:"subscribe",topics:[].concat(topics)}));},` +
+	`unsubscribe:function(topics){this.sendMessage(Ext.encode({type:"unsubscribe",topics:[].concat(topics)}));},` +
+	`sendRequest:function(t){var me=this,p=me.getPayload||me.getCallData,ts=[].concat(t);` +
+	`if(!window.WebSocket||ts[0].isForm||ts[0].form){return me.callParent(arguments);}` +
+	`me.sendMessage(Ext.encode(Ext.Array.map(ts,function(x){return p.call(me,x);})));}})`
+
+// webSocketJavaScript returns definition of WebSocket provider class and its config or empty string if
+// WebSocket URL is not set.
+func (provider DirectServiceProvider) webSocketJavaScript() (string, error) {
+	if provider.webSocket.url == "" {
+		return "", nil
+	}
+	urlJSON, err := json.Marshal(provider.webSocket.url)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(webSocketProviderScript + `;%[1]s.WEBSOCKET_API=Ext.apply(Ext.apply({},%[1]s.REMOTE_API),{type:"websocketprovider",wsUrl:%[2]s})`,
+		provider.Namespace, string(urlJSON)), nil
+}